@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/MythicAgents/forgescript/pkg/agentfunctions"
+	"github.com/MythicAgents/forgescript/pkg/config"
+)
+
+// Writes the loaded bundles and their files to an archive which can be imported on
+// another container with forgescript_import
+func runExport(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	runtimeDir := flags.String("runtime-dir", "", "Runtime path of the container to export")
+	outputPath := flags.String("o", "forgescript-export.tar.gz", "File to write the export to")
+	flags.Parse(args)
+
+	if len(*runtimeDir) > 0 {
+		config.SetForgeScriptRuntimePath(*runtimeDir)
+	}
+
+	outFile, err := os.OpenFile(*outputPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed creating %s (%s)\n", *outputPath, err.Error())
+		return 1
+	}
+	defer outFile.Close()
+
+	exported, skipped, err := agentfunctions.ExportRegistry(outFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed exporting bundles (%s)\n", err.Error())
+		os.Remove(*outputPath)
+		return 1
+	}
+
+	for _, name := range exported {
+		fmt.Printf("Exported bundle %s\n", name)
+	}
+
+	for _, reason := range skipped {
+		fmt.Fprintf(os.Stderr, "Skipped bundle %s\n", reason)
+	}
+
+	fmt.Printf("Wrote %d bundles to %s\n", len(exported), *outputPath)
+	return 0
+}
@@ -8,8 +8,10 @@ import (
 
 	"github.com/MythicAgents/forgescript/pkg/agentfunctions"
 	"github.com/MythicAgents/forgescript/pkg/config"
+	"github.com/MythicAgents/forgescript/pkg/policy"
 	_ "github.com/MythicAgents/forgescript/pkg/pymodule"
 	"github.com/MythicAgents/forgescript/pkg/python"
+	"github.com/MythicAgents/forgescript/pkg/signing"
 	"github.com/MythicMeta/MythicContainer"
 )
 
@@ -20,11 +22,75 @@ func main() {
 	}
 
 	runtimeDir := flag.String("runtime-dir", "", "Set the runtime path")
+	preloadDir := flag.String("preload-dir", "", "Directory of bundles to load when the container starts")
+	watchDir := flag.String("watch-dir", "", "Unpacked bundle directory to load and reload whenever its files change")
+	aliasConflict := flag.String("alias-conflict", string(config.AliasConflictReplace), "Policy for alias names already in use (reject, replace, prefix)")
+	trustedKeys := flag.String("trusted-keys", "", "File containing the public keys trusted to sign bundles")
+	requireSigned := flag.Bool("require-signed", false, "Refuse to load bundles without a valid signature")
+	policyFile := flag.String("policy-file", "", "File containing the policies for loading, unloading and invoking aliases")
+	requireApproval := flag.Bool("require-approval", false, "Keep aliases from loaded bundles inactive until a second operator approves them")
+	runFromArchive := flag.Bool("run-from-archive", false, "Run zip bundles from the archive in memory instead of extracting them")
+	loadTimeout := flag.Duration("load-timeout", config.GetLoadTimeout(), "Maximum time a bundle's entry scripts may run when it is loaded (0 for no limit)")
+	invokeTimeout := flag.Duration("invoke-timeout", config.GetInvokeTimeout(), "Maximum time an alias callback may run for a single task (0 for no limit)")
+
+	bundleLimits := config.GetBundleLimits()
+	flag.Int64Var(&bundleLimits.CompressedSize, "max-bundle-size", bundleLimits.CompressedSize, "Maximum size in bytes of an uploaded bundle (0 for no limit)")
+	flag.Int64Var(&bundleLimits.DecompressedSize, "max-extracted-size", bundleLimits.DecompressedSize, "Maximum size in bytes of a decompressed or extracted bundle (0 for no limit)")
+	flag.IntVar(&bundleLimits.Entries, "max-bundle-entries", bundleLimits.Entries, "Maximum number of entries in a bundle (0 for no limit)")
+	flag.IntVar(&bundleLimits.PathDepth, "max-path-depth", bundleLimits.PathDepth, "Maximum directory depth of a bundle entry (0 for no limit)")
+	flag.Int64Var(&bundleLimits.FileSize, "max-file-size", bundleLimits.FileSize, "Maximum size in bytes of a single file in a bundle (0 for no limit)")
 	flag.Parse()
+
+	config.SetBundleLimits(bundleLimits)
 	if runtimeDir != nil && len(*runtimeDir) > 0 {
 		config.SetForgeScriptRuntimePath(*runtimeDir)
 	}
 
+	if err := config.SetAliasConflictPolicy(*aliasConflict); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		os.Exit(2)
+	}
+
+	if *loadTimeout < 0 || *invokeTimeout < 0 {
+		fmt.Fprintf(os.Stderr, "-load-timeout and -invoke-timeout cannot be negative\n")
+		os.Exit(2)
+	}
+
+	if len(*trustedKeys) > 0 {
+		if _, err := signing.LoadTrustedKeys(*trustedKeys); err != nil {
+			fmt.Fprintf(os.Stderr, "could not load trusted keys from %s (%s)\n", *trustedKeys, err.Error())
+			os.Exit(2)
+		}
+	} else if *requireSigned {
+		fmt.Fprintf(os.Stderr, "-require-signed needs a list of trusted keys from -trusted-keys\n")
+		os.Exit(2)
+	}
+
+	if len(*policyFile) > 0 {
+		if _, err := policy.Load(*policyFile); err != nil {
+			fmt.Fprintf(os.Stderr, "could not load policies from %s (%s)\n", *policyFile, err.Error())
+			os.Exit(2)
+		}
+	}
+
+	config.SetTrustedKeysPath(*trustedKeys)
+	config.SetPolicyPath(*policyFile)
+	config.SetRequireSignedBundles(*requireSigned)
+	config.SetRunFromArchive(*runFromArchive)
+	config.SetRequireApproval(*requireApproval)
+	config.SetLoadTimeout(*loadTimeout)
+	config.SetInvokeTimeout(*invokeTimeout)
+	config.SetPreloadPath(*preloadDir)
+	config.SetWatchPath(*watchDir)
+
+	if subcommand == "keygen" {
+		os.Exit(runKeygen(os.Args[2:]))
+	} else if subcommand == "sign" {
+		os.Exit(runSign(os.Args[2:]))
+	} else if subcommand == "export" {
+		os.Exit(runExport(os.Args[2:]))
+	}
+
 	if subcommand == "clean" {
 		exitCode := 0
 
@@ -48,6 +114,11 @@ func main() {
 	agentfunctions.Initialize()
 
 	go func() {
+		// Load scripts can only run once the Python executor loop has started on the
+		// main thread so bundles are preloaded here instead of in Initialize
+		agentfunctions.PreloadBundles()
+		agentfunctions.WatchBundle()
+
 		MythicContainer.StartAndRunForever([]MythicContainer.MythicServices{
 			MythicContainer.MythicServicePayload,
 		})
@@ -0,0 +1,191 @@
+package agentfunctions
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/MythicAgents/forgescript/pkg/python"
+	"github.com/MythicMeta/MythicContainer/logging"
+)
+
+// Identifies the interpreter of a script in a loaded bundle
+type aliasInterpreterKey struct {
+	fileID     string
+	scriptPath string
+}
+
+// Interpreter holding the alias callbacks of a script. It is the interpreter which ran
+// the script when the bundle was loaded, so module level code runs once per load and
+// its state persists across invocations. Interpreters do not survive a container
+// restart or an alias callback running over its timeout, in which case the script is
+// run once more in a new interpreter on the next invocation of one of its aliases
+type aliasInterpreter struct {
+	mutex       sync.Mutex
+	digest      string
+	interpreter *python.ScriptInterpreter
+	closed      bool
+}
+
+var (
+	// Interpreters of the loaded bundles. Dropped when the bundle is unloaded or
+	// replaced
+	aliasInterpreters      = map[aliasInterpreterKey]*aliasInterpreter{}
+	aliasInterpretersMutex sync.Mutex
+)
+
+// Runs the alias callback from the interpreter of the script of the bundle. The script
+// is only run again if the bundle has no interpreter for it
+func runCachedAliasCallback(bundle *RegisteredBundle, alias RegisteredAlias, taskID int, taskJson string) (string, error) {
+	key := aliasInterpreterKey{fileID: bundle.FileID, scriptPath: alias.ScriptPath}
+
+	aliasInterpretersMutex.Lock()
+	cached, ok := aliasInterpreters[key]
+	if !ok || cached.digest != bundle.SHA256 {
+		// An interpreter left from an earlier bundle with the same file ID
+		if ok {
+			go cached.close()
+		}
+
+		cached = &aliasInterpreter{digest: bundle.SHA256}
+		aliasInterpreters[key] = cached
+	}
+	aliasInterpretersMutex.Unlock()
+
+	interpreter, err := cached.load(bundle, alias, taskID)
+	if err != nil {
+		return "", err
+	}
+
+	result, err := interpreter.RunAliasCallback(taskID, alias.CallbackName(), taskJson, bundle.invokeTimeout())
+	if errors.Is(err, python.ErrTimeout) {
+		// The interpreter is deleted once the callback returns so the next invocation
+		// runs the script again in a new one
+		aliasInterpretersMutex.Lock()
+		if aliasInterpreters[key] == cached {
+			delete(aliasInterpreters, key)
+		}
+		aliasInterpretersMutex.Unlock()
+
+		go cached.close()
+	}
+
+	return result, err
+}
+
+// Returns the interpreter, running the script of the alias first if it was not loaded
+func (cached *aliasInterpreter) load(bundle *RegisteredBundle, alias RegisteredAlias, taskID int) (*python.ScriptInterpreter, error) {
+	cached.mutex.Lock()
+	defer cached.mutex.Unlock()
+
+	if cached.closed {
+		return nil, errors.New("bundle was unloaded while the alias was running")
+	} else if cached.interpreter != nil {
+		return cached.interpreter, nil
+	}
+
+	logging.LogInfo("Running script again to load alias callbacks", "file_id", bundle.FileID, "script", alias.ScriptPath)
+
+	var interpreter *python.ScriptInterpreter
+	if len(alias.Archive) > 0 {
+		archive, err := packedArchive(alias.Archive)
+		if err != nil {
+			logging.LogError(err, "Could not load bundle archive", "sha256", alias.Archive)
+			return nil, err
+		}
+
+		archiveName := packedArchiveName(alias.Archive)
+		interpreter, err = python.LoadArchiveScriptInterpreter(archive, archiveName, strings.TrimPrefix(alias.ScriptPath, archiveName+"/"), taskID, bundle.loadTimeout())
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		interpreter, err = python.LoadScriptInterpreter(alias.ScriptPath, taskID, bundle.loadTimeout())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cached.interpreter = interpreter
+	return interpreter, nil
+}
+
+func (cached *aliasInterpreter) close() {
+	cached.mutex.Lock()
+	defer cached.mutex.Unlock()
+
+	cached.closed = true
+	if cached.interpreter != nil {
+		cached.interpreter.Close()
+		cached.interpreter = nil
+	}
+}
+
+// Closes the interpreters of the bundle so the next invocation of an alias with the
+// same file ID runs its script again
+func dropAliasInterpreters(fileID string) {
+	aliasInterpretersMutex.Lock()
+	defer aliasInterpretersMutex.Unlock()
+
+	for key, cached := range aliasInterpreters {
+		if key.fileID == fileID {
+			delete(aliasInterpreters, key)
+			go cached.close()
+		}
+	}
+}
+
+// Keeps the interpreters which ran the entry scripts of the committed bundle for its
+// aliases and closes the ones which registered none of them. The registry mutex must be
+// held
+func keepLoadInterpreters(bundle *RegisteredBundle) {
+	kept := map[aliasInterpreterKey]*python.ScriptInterpreter{}
+	for _, alias := range bundle.Aliases {
+		key := aliasInterpreterKey{fileID: bundle.FileID, scriptPath: alias.ScriptPath}
+		if _, ok := kept[key]; ok {
+			continue
+		}
+
+		idx := slices.IndexFunc(bundle.interpreters, func(interpreter *python.ScriptInterpreter) bool {
+			return interpreter.HasCallback(alias.CallbackName())
+		})
+
+		if idx >= 0 {
+			kept[key] = bundle.interpreters[idx]
+		}
+	}
+
+	aliasInterpretersMutex.Lock()
+	for key, interpreter := range kept {
+		if cached, ok := aliasInterpreters[key]; ok {
+			go cached.close()
+		}
+
+		aliasInterpreters[key] = &aliasInterpreter{digest: bundle.SHA256, interpreter: interpreter}
+	}
+	aliasInterpretersMutex.Unlock()
+
+	bundle.interpreters = slices.DeleteFunc(bundle.interpreters, func(interpreter *python.ScriptInterpreter) bool {
+		for _, keptInterpreter := range kept {
+			if keptInterpreter == interpreter {
+				return true
+			}
+		}
+
+		return false
+	})
+
+	closeLoadInterpreters(bundle)
+}
+
+// Closes the interpreters of a load which was not committed. The registry mutex must be
+// held
+func closeLoadInterpreters(bundle *RegisteredBundle) {
+	for _, interpreter := range bundle.interpreters {
+		interpreter.Close()
+	}
+
+	bundle.interpreters = nil
+}
@@ -0,0 +1,109 @@
+package agentfunctions
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	agentstructs "github.com/MythicMeta/MythicContainer/agent_structs"
+)
+
+func parameterIsRequired(param agentstructs.CommandParameter) bool {
+	return slices.ContainsFunc(param.ParameterGroupInformation, func(group agentstructs.ParameterGroupInfo) bool {
+		return group.ParameterIsRequired
+	})
+}
+
+func diffField(name string, previous any, current any) []string {
+	if reflect.DeepEqual(previous, current) {
+		return []string{}
+	}
+
+	return []string{fmt.Sprintf("%s: %#v -> %#v", name, previous, current)}
+}
+
+func diffParameter(previous agentstructs.CommandParameter, current agentstructs.CommandParameter) []string {
+	return slices.Concat(
+		diffField("type", previous.ParameterType, current.ParameterType),
+		diffField("description", previous.Description, current.Description),
+		diffField("default", previous.DefaultValue, current.DefaultValue),
+		diffField("choices", previous.Choices, current.Choices),
+		diffField("required", parameterIsRequired(previous), parameterIsRequired(current)),
+	)
+}
+
+// Returns the changes between two versions of an alias command. Each entry is a
+// single changed attribute or parameter
+func diffCommand(previous agentstructs.Command, current agentstructs.Command) []string {
+	changes := slices.Concat(
+		diffField("description", previous.Description, current.Description),
+		diffField("help", previous.HelpString, current.HelpString),
+		diffField("version", previous.Version, current.Version),
+		diffField("author", previous.Author, current.Author),
+		diffField("supported os", previous.CommandAttributes.SupportedOS, current.CommandAttributes.SupportedOS),
+	)
+
+	for _, param := range current.CommandParameters {
+		idx := slices.IndexFunc(previous.CommandParameters, func(p agentstructs.CommandParameter) bool {
+			return p.Name == param.Name
+		})
+
+		if idx < 0 {
+			changes = append(changes, fmt.Sprintf("added parameter %s (%s)", param.Name, param.ParameterType))
+			continue
+		}
+
+		for _, change := range diffParameter(previous.CommandParameters[idx], param) {
+			changes = append(changes, fmt.Sprintf("parameter %s %s", param.Name, change))
+		}
+	}
+
+	for _, param := range previous.CommandParameters {
+		if !slices.ContainsFunc(current.CommandParameters, func(p agentstructs.CommandParameter) bool {
+			return p.Name == param.Name
+		}) {
+			changes = append(changes, fmt.Sprintf("removed parameter %s", param.Name))
+		}
+	}
+
+	return changes
+}
+
+// Formats the aliases added, removed and changed between two versions of a bundle
+func formatAliasDiff(previous []RegisteredAlias, current []RegisteredAlias) string {
+	lines := []string{}
+
+	findAlias := func(aliases []RegisteredAlias, name string) int {
+		return slices.IndexFunc(aliases, func(alias RegisteredAlias) bool {
+			return alias.Command.Name == name
+		})
+	}
+
+	for _, alias := range current {
+		idx := findAlias(previous, alias.Command.Name)
+		if idx < 0 {
+			lines = append(lines, fmt.Sprintf("+ %s", alias.Command.Name))
+			continue
+		}
+
+		changes := diffCommand(previous[idx].Command, alias.Command)
+		if len(changes) == 0 {
+			lines = append(lines, fmt.Sprintf("  %s", alias.Command.Name))
+			continue
+		}
+
+		lines = append(lines, fmt.Sprintf("~ %s", alias.Command.Name))
+		for _, change := range changes {
+			lines = append(lines, fmt.Sprintf("    %s", change))
+		}
+	}
+
+	for _, alias := range previous {
+		if findAlias(current, alias.Command.Name) < 0 {
+			lines = append(lines, fmt.Sprintf("- %s", alias.Command.Name))
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,78 @@
+package agentfunctions
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	agentstructs "github.com/MythicMeta/MythicContainer/agent_structs"
+	"github.com/MythicMeta/MythicContainer/logging"
+	"github.com/MythicMeta/MythicContainer/mythicrpc"
+)
+
+// Maximum length of the argument summary written to the operation event log
+const auditArgsSummaryLength = 256
+
+// Writes a message for the task to the operation event log. Failures are logged and do
+// not fail the task
+func writeAuditEntry(taskData *agentstructs.PTTaskMessageAllData, level mythicrpc.MESSAGE_LEVEL, message string) {
+	taskID := taskData.Task.ID
+	response, err := mythicrpc.SendMythicRPCOperationEventLogCreate(mythicrpc.MythicRPCOperationEventLogCreateMessage{
+		TaskId:       &taskID,
+		Message:      message,
+		MessageLevel: level,
+	})
+
+	if err == nil && !response.Success {
+		err = fmt.Errorf("%s", response.Error)
+	}
+
+	if err != nil {
+		logging.LogError(err, "could not write to the operation event log", "task_id", taskID)
+	}
+}
+
+// Records a bundle loaded by a task in the operation event log
+func auditBundleLoad(taskData *agentstructs.PTTaskMessageAllData, bundle *RegisteredBundle) {
+	aliasNames := []string{}
+	for _, alias := range bundle.Aliases {
+		aliasNames = append(aliasNames, alias.Command.Name)
+	}
+
+	aliases := "no aliases"
+	if len(aliasNames) > 0 {
+		aliases = "aliases " + strings.Join(aliasNames, ", ")
+	}
+
+	writeAuditEntry(taskData, mythicrpc.MESSAGE_LEVEL_INFO, fmt.Sprintf("%s: %s loaded bundle %s (sha256 %s) from file %s on callback %d (task %d) with %s",
+		payloadName, taskData.Task.OperatorUsername, bundle.Name, bundle.SHA256, bundle.FileID,
+		taskData.Callback.DisplayID, taskData.Task.ID, aliases))
+}
+
+// Records an alias invocation and the command it was translated into in the operation
+// event log
+func auditAliasInvocation(taskData *agentstructs.PTTaskMessageAllData, aliasName string, bundle *RegisteredBundle, aliasCommand AliasCommand) {
+	bundleName, bundleHash := "(unknown)", "(unknown)"
+	if bundle != nil {
+		bundleName, bundleHash = bundle.Name, bundle.SHA256
+	}
+
+	writeAuditEntry(taskData, mythicrpc.MESSAGE_LEVEL_INFO, fmt.Sprintf("%s: %s invoked alias %s from bundle %s (sha256 %s) on callback %d (task %d) as %s %s with args %s",
+		payloadName, taskData.Task.OperatorUsername, aliasName, bundleName, bundleHash,
+		taskData.Callback.DisplayID, taskData.Task.ID, taskData.PayloadType, aliasCommand.Name,
+		summarizeArgs(aliasCommand.Args)))
+}
+
+// Returns the arguments as JSON, truncated to auditArgsSummaryLength
+func summarizeArgs(args map[string]any) string {
+	summary, err := json.Marshal(args)
+	if err != nil {
+		return "(unserializable)"
+	}
+
+	if len(summary) <= auditArgsSummaryLength {
+		return string(summary)
+	}
+
+	return strings.ToValidUTF8(string(summary[:auditArgsSummaryLength]), "") + fmt.Sprintf("... (%d bytes)", len(summary))
+}
@@ -0,0 +1,440 @@
+package agentfunctions
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/MythicAgents/forgescript/pkg/config"
+	"github.com/MythicAgents/forgescript/pkg/extract"
+	"github.com/MythicAgents/forgescript/pkg/manifest"
+	"github.com/MythicAgents/forgescript/pkg/signing"
+	"github.com/MythicAgents/forgescript/pkg/versioninfo"
+	"github.com/MythicMeta/MythicContainer/logging"
+	"github.com/MythicMeta/MythicContainer/mythicrpc"
+)
+
+// Contents of the bundles run from their zip archive keyed by SHA-256 digest. Archives
+// are only kept in memory and fetched from Mythic again after a restart. Guarded by
+// the registry mutex
+var packedArchives = map[string][]byte{}
+
+// Returns the SHA-256 digest identifying the contents of a bundle. The script name
+// is part of the contents of a bundle which is a single Python script
+func bundleDigest(content []byte, fileExtractor extract.BundleExtractor) string {
+	hash := sha256.New()
+	if scriptExtractor, ok := fileExtractor.(extract.ScriptExtractor); ok {
+		hash.Write([]byte(scriptExtractor.ScriptName()))
+		hash.Write([]byte{0})
+	}
+
+	hash.Write(content)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Checks that the script exists in the bundle and is a regular file
+func checkBundleScript(bundleFiles fs.FS, scriptName string) error {
+	scriptStat, err := fs.Stat(bundleFiles, path.Clean(scriptName))
+	if err != nil {
+		return fmt.Errorf("script '%s' not found in bundle", scriptName)
+	} else if scriptStat.IsDir() {
+		return errors.New("specified path for bundle script is a directory")
+	}
+
+	return nil
+}
+
+// Returns the SHA-256 hash of every file in the bundle keyed by path
+func hashBundleFiles(bundleFiles fs.FS) (map[string]string, error) {
+	hashes := map[string]string{}
+
+	err := fs.WalkDir(bundleFiles, ".", func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			return nil
+		} else if !entry.Type().IsRegular() {
+			return fmt.Errorf("%s is not a regular file", filePath)
+		}
+
+		file, err := bundleFiles.Open(filePath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		hash := sha256.New()
+		if _, err := io.Copy(hash, file); err != nil {
+			return err
+		}
+
+		hashes[filePath] = hex.EncodeToString(hash.Sum(nil))
+		return nil
+	})
+
+	return hashes, err
+}
+
+// Returns the SHA-256 hash of every file in an extracted bundle keyed by path
+func hashExtractedBundle(extractPath string) (map[string]string, error) {
+	root, err := os.OpenRoot(extractPath)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+
+	return hashBundleFiles(root.FS())
+}
+
+// Returned when the files of an extracted bundle differ from the files recorded when
+// it was loaded
+type bundleIntegrityError struct {
+	modified []string
+	added    []string
+	removed  []string
+}
+
+func (e bundleIntegrityError) Error() string {
+	changes := []string{}
+	for _, change := range []struct {
+		name  string
+		files []string
+	}{{"modified", e.modified}, {"added", e.added}, {"removed", e.removed}} {
+		if len(change.files) > 0 {
+			changes = append(changes, fmt.Sprintf("%s %s", change.name, strings.Join(change.files, ", ")))
+		}
+	}
+
+	return fmt.Sprintf("bundle files changed since the bundle was loaded (%s)", strings.Join(changes, "; "))
+}
+
+// Compares the files of an extracted bundle against the hashes recorded when it was
+// loaded. Nothing is checked if no hashes were recorded
+func checkBundleIntegrity(extractPath string, recorded map[string]string) error {
+	if recorded == nil {
+		return nil
+	}
+
+	current, err := hashExtractedBundle(extractPath)
+	if err != nil {
+		return fmt.Errorf("could not hash bundle files %w", err)
+	}
+
+	mismatch := bundleIntegrityError{}
+	for filePath, hash := range recorded {
+		if currentHash, ok := current[filePath]; !ok {
+			mismatch.removed = append(mismatch.removed, filePath)
+		} else if currentHash != hash {
+			mismatch.modified = append(mismatch.modified, filePath)
+		}
+	}
+
+	for filePath := range current {
+		if _, ok := recorded[filePath]; !ok {
+			mismatch.added = append(mismatch.added, filePath)
+		}
+	}
+
+	if len(mismatch.modified)+len(mismatch.added)+len(mismatch.removed) == 0 {
+		return nil
+	}
+
+	slices.Sort(mismatch.modified)
+	slices.Sort(mismatch.added)
+	slices.Sort(mismatch.removed)
+	return mismatch
+}
+
+// Checks that the files of the bundle which registered the alias were not changed
+// since it was loaded. Bundles run from their archive are checked against their
+// digest when the archive is fetched instead
+func verifyAliasBundle(name string) error {
+	bundle := aliasBundle(name)
+	if bundle == nil || bundle.Packed {
+		return nil
+	}
+
+	if err := checkBundleIntegrity(bundle.ExtractPath, bundle.FileHashes); err != nil {
+		return fmt.Errorf("refusing to run alias '%s' from bundle '%s' (%s) %w", name, bundle.Name, bundle.FileID, err)
+	}
+
+	return nil
+}
+
+// Returns the file hashes recorded for a loaded bundle or a bundle being loaded with
+// the digest or nil if there is no such bundle
+func recordedFileHashes(digest string) map[string]string {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	for _, bundle := range bundlesInUse() {
+		if bundle.SHA256 == digest && !bundle.Packed && bundle.FileHashes != nil {
+			return bundle.FileHashes
+		}
+	}
+
+	return nil
+}
+
+// Lock held by loads of the same digest while extracting the bundle and until the
+// load is staged, so that an extraction is never replaced before its load claims it
+type digestLock struct {
+	mutex   sync.Mutex
+	waiters int
+}
+
+var (
+	digestLocks      = map[string]*digestLock{}
+	digestLocksMutex sync.Mutex
+)
+
+// Locks the digest and returns the function which unlocks it. The function may be
+// called more than once
+func lockDigest(digest string) func() {
+	digestLocksMutex.Lock()
+	lock, ok := digestLocks[digest]
+	if !ok {
+		lock = &digestLock{}
+		digestLocks[digest] = lock
+	}
+	lock.waiters += 1
+	digestLocksMutex.Unlock()
+
+	lock.mutex.Lock()
+	return sync.OnceFunc(func() {
+		lock.mutex.Unlock()
+
+		digestLocksMutex.Lock()
+		defer digestLocksMutex.Unlock()
+
+		lock.waiters -= 1
+		if lock.waiters == 0 {
+			delete(digestLocks, digest)
+		}
+	})
+}
+
+// Returns true if a loaded bundle or a bundle being loaded uses the extraction
+func extractionInUse(extractPath string) bool {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	return extractPathInUse(extractPath)
+}
+
+// Extracts the bundle to the bundle store under its digest. Bundles with the same
+// digest share a single extraction. An existing extraction is only reused if it
+// matches the hashes recorded for a bundle with the digest and is replaced otherwise,
+// unless a bundle still uses it.
+// The digest stays locked until the returned function is called, which must happen
+// once the load is staged with beginBundleLoad or abandoned.
+// Returns the path of the extracted bundle and whether an existing extraction was reused
+func extractBundle(fileExtractor extract.BundleExtractor, digest string) (string, bool, func(), error) {
+	storePath := config.GetForgeScriptBundleExtractPath()
+	extractPath := path.Join(storePath, digest)
+
+	unlock := lockDigest(digest)
+	extractPath, reused, err := extractBundleLocked(fileExtractor, storePath, extractPath, digest)
+	if err != nil {
+		unlock()
+		return "", false, unlock, err
+	}
+
+	return extractPath, reused, unlock, nil
+}
+
+func extractBundleLocked(fileExtractor extract.BundleExtractor, storePath string, extractPath string, digest string) (string, bool, error) {
+	if info, err := os.Stat(extractPath); err == nil && info.IsDir() {
+		recorded := recordedFileHashes(digest)
+		if recorded != nil {
+			if err := checkBundleIntegrity(extractPath, recorded); err != nil {
+				logging.LogError(err, "bundle extraction was modified", "path", extractPath)
+			} else {
+				return extractPath, true, nil
+			}
+		}
+
+		if extractionInUse(extractPath) {
+			return "", false, fmt.Errorf("existing extraction of the bundle at %s was modified and is still used by a loaded bundle. Unload that bundle first", extractPath)
+		}
+
+		// Left behind by a bundle which is no longer loaded or modified, so nothing
+		// vouches for its contents
+		logging.LogInfo("Replacing bundle extraction", "path", extractPath)
+		if err := os.RemoveAll(extractPath); err != nil {
+			return "", false, fmt.Errorf("could not remove existing extracted bundle %w", err)
+		}
+	}
+
+	if err := os.MkdirAll(storePath, 0700); err != nil {
+		return "", false, fmt.Errorf("could not create path for extracted bundle %w", err)
+	}
+
+	// Extract to a temporary directory first so that a partially extracted bundle is
+	// never reused
+	tmpPath, err := os.MkdirTemp(storePath, digest+".tmp-")
+	if err != nil {
+		return "", false, fmt.Errorf("could not create path for extracted bundle %w", err)
+	}
+	defer os.RemoveAll(tmpPath)
+
+	extractDir, err := os.OpenRoot(tmpPath)
+	if err != nil {
+		return "", false, fmt.Errorf("could not open path for extracting the bundle %w", err)
+	}
+	defer extractDir.Close()
+
+	if _, err := fileExtractor.ExtractTo(extractDir); err != nil {
+		return "", false, fmt.Errorf("could not extract bundle %w", err)
+	}
+
+	if err := os.Rename(tmpPath, extractPath); err != nil {
+		// Another task finished extracting the same bundle first
+		if info, statErr := os.Stat(extractPath); statErr == nil && info.IsDir() {
+			return extractPath, true, nil
+		}
+
+		return "", false, fmt.Errorf("could not store extracted bundle %w", err)
+	}
+
+	return extractPath, false, nil
+}
+
+// Checks the signature of the bundle against the trusted keys.
+// Returns the name of the signer or an empty name if the bundle is unsigned and
+// unsigned bundles are allowed
+func verifyBundleSignature(bundleFiles fs.FS) (string, error) {
+	keys, err := signing.LoadTrustedKeys(config.GetTrustedKeysPath())
+	if err != nil {
+		return "", fmt.Errorf("could not load trusted keys %w", err)
+	}
+
+	signer, err := signing.VerifyBundle(bundleFiles, keys)
+	if errors.Is(err, signing.ErrUnsigned) {
+		if config.GetRequireSignedBundles() {
+			return "", errors.New("bundle is not signed and only signed bundles can be loaded")
+		}
+
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("bundle signature verification failed %w", err)
+	}
+
+	return signer, nil
+}
+
+// Checks the signature of an extracted bundle against the trusted keys
+func verifyExtractedBundle(extractPath string) (string, error) {
+	root, err := os.OpenRoot(extractPath)
+	if err != nil {
+		return "", err
+	}
+	defer root.Close()
+
+	return verifyBundleSignature(root.FS())
+}
+
+// Reads the manifest from the bundle and checks that it is compatible with this
+// forgescript version.
+// Returns nil if the bundle does not have a manifest
+func loadBundleManifest(bundleFiles fs.FS) (*manifest.Manifest, error) {
+	bundleManifest, err := manifest.Load(bundleFiles)
+	if err != nil || bundleManifest == nil {
+		return nil, err
+	}
+
+	if err := bundleManifest.CheckVersion(versioninfo.ModuleVersion()); err != nil {
+		return nil, err
+	}
+
+	for _, supportedOS := range bundleManifest.SupportedOS {
+		if !slices.Contains(supportedOSList, supportedOS) {
+			return nil, fmt.Errorf("bundle manifest has unknown supported OS '%s' (expected one of %v)", supportedOS, supportedOSList)
+		}
+	}
+
+	return bundleManifest, nil
+}
+
+// Returns the name used as the path of a packed bundle archive in Python
+func packedArchiveName(digest string) string {
+	return digest + ".zip"
+}
+
+// Returns the archive of a packed bundle. Archives which are no longer in memory are
+// fetched from Mythic and checked against the digest and signature of the bundle
+func packedArchive(digest string) ([]byte, error) {
+	registryMutex.Lock()
+	if archive, ok := packedArchives[digest]; ok {
+		registryMutex.Unlock()
+		return archive, nil
+	}
+
+	idx := slices.IndexFunc(registry.Bundles, func(bundle *RegisteredBundle) bool {
+		return bundle.Packed && bundle.SHA256 == digest
+	})
+
+	if idx < 0 {
+		registryMutex.Unlock()
+		return nil, fmt.Errorf("bundle archive %s is not loaded", digest)
+	}
+
+	fileID := registry.Bundles[idx].FileID
+	signed := len(registry.Bundles[idx].Signer) > 0
+	registryMutex.Unlock()
+
+	fileContentResponse, err := mythicrpc.SendMythicRPCFileGetContent(mythicrpc.MythicRPCFileGetContentMessage{
+		AgentFileID: fileID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch bundle archive %s %w", fileID, err)
+	} else if !fileContentResponse.Success {
+		return nil, fmt.Errorf("could not fetch bundle archive %s %s", fileID, fileContentResponse.Error)
+	}
+
+	archive := fileContentResponse.Content
+	if sum := sha256.Sum256(archive); hex.EncodeToString(sum[:]) != digest {
+		return nil, fmt.Errorf("bundle archive %s does not match the loaded bundle", fileID)
+	}
+
+	// Signed bundles are checked again in case the trusted keys changed
+	if signed || config.GetRequireSignedBundles() {
+		bundleFiles, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := verifyBundleSignature(bundleFiles); err != nil {
+			return nil, err
+		}
+	}
+
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	if archiveInUse(digest) {
+		packedArchives[digest] = archive
+	}
+
+	return archive, nil
+}
+
+// Keeps the archive of a packed bundle being loaded in memory
+func storePackedArchive(digest string, archive []byte) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	packedArchives[digest] = archive
+}
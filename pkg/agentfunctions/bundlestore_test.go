@@ -0,0 +1,117 @@
+package agentfunctions
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/MythicAgents/forgescript/pkg/config"
+	"github.com/MythicAgents/forgescript/pkg/extract"
+	"github.com/stretchr/testify/assert"
+)
+
+const testBundleScript = "import forgescript\n"
+
+func createTestBundleTar(t *testing.T) []byte {
+	var tarBuf bytes.Buffer
+	tarw := tar.NewWriter(&tarBuf)
+	assert.Nil(t, tarw.WriteHeader(&tar.Header{
+		Name: defaultLoadScript,
+		Mode: 0600,
+		Size: int64(len(testBundleScript)),
+	}), "failed writing test tar header")
+	tarw.Write([]byte(testBundleScript))
+	assert.Nil(t, tarw.Close(), "failed creating test tar file")
+
+	return tarBuf.Bytes()
+}
+
+func TestExtractBundleConcurrent(t *testing.T) {
+	config.SetForgeScriptRuntimePath(t.TempDir())
+
+	content := createTestBundleTar(t)
+	sum := sha256.Sum256(content)
+	digest := hex.EncodeToString(sum[:])
+
+	newExtractor := func() extract.BundleExtractor {
+		fileExtractor, err := extract.NewBundleExtractor(bytes.NewReader(content), int64(len(content)), "bundle.tar", config.GetBundleLimits())
+		assert.Nil(t, err, "NewBundleExtractor() returned an error")
+		return fileExtractor
+	}
+
+	extractPath, reused, unlock, err := extractBundle(newExtractor(), digest)
+	assert.Nil(t, err, "extractBundle() returned an error")
+	assert.False(t, reused, "first extraction should not be reused")
+	defer abortBundleLoad(-100)
+
+	type result struct {
+		extractPath string
+		reused      bool
+		err         error
+	}
+
+	// A second load of the same digest starts before the first load is staged
+	second := make(chan result, 1)
+	go func() {
+		extractPath, reused, unlock, err := extractBundle(newExtractor(), digest)
+		unlock()
+		second <- result{extractPath, reused, err}
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+
+	data, err := os.ReadFile(path.Join(extractPath, defaultLoadScript))
+	assert.Nil(t, err, "extraction was replaced before the first load was staged")
+	assert.Equal(t, testBundleScript, string(data))
+
+	hashes, err := hashExtractedBundle(extractPath)
+	assert.Nil(t, err, "hashExtractedBundle() returned an error")
+
+	beginBundleLoad(-100, &RegisteredBundle{SHA256: digest, ExtractPath: extractPath, FileHashes: hashes}, "")
+	unlock()
+
+	secondResult := <-second
+	assert.Nil(t, secondResult.err, "second extractBundle() returned an error")
+	assert.Equal(t, extractPath, secondResult.extractPath)
+	assert.True(t, secondResult.reused, "second load should reuse the extraction of the first load")
+}
+
+func TestExtractBundleModifiedInUse(t *testing.T) {
+	config.SetForgeScriptRuntimePath(t.TempDir())
+
+	content := createTestBundleTar(t)
+	sum := sha256.Sum256(content)
+	digest := hex.EncodeToString(sum[:])
+
+	fileExtractor, err := extract.NewBundleExtractor(bytes.NewReader(content), int64(len(content)), "bundle.tar", config.GetBundleLimits())
+	assert.Nil(t, err, "NewBundleExtractor() returned an error")
+
+	extractPath, _, unlock, err := extractBundle(fileExtractor, digest)
+	assert.Nil(t, err, "extractBundle() returned an error")
+
+	hashes, err := hashExtractedBundle(extractPath)
+	assert.Nil(t, err, "hashExtractedBundle() returned an error")
+
+	beginBundleLoad(-200, &RegisteredBundle{SHA256: digest, ExtractPath: extractPath, FileHashes: hashes}, "")
+	defer abortBundleLoad(-200)
+	unlock()
+
+	scriptPath := path.Join(extractPath, defaultLoadScript)
+	assert.Nil(t, os.WriteFile(scriptPath, []byte("import os\n"), 0600), "failed modifying extracted script")
+
+	fileExtractor, err = extract.NewBundleExtractor(bytes.NewReader(content), int64(len(content)), "bundle.tar", config.GetBundleLimits())
+	assert.Nil(t, err, "NewBundleExtractor() returned an error")
+
+	_, _, unlock, err = extractBundle(fileExtractor, digest)
+	unlock()
+	assert.NotNil(t, err, "modified extraction used by a bundle was replaced")
+
+	data, err := os.ReadFile(scriptPath)
+	assert.Nil(t, err, "extraction used by a bundle was removed")
+	assert.Equal(t, "import os\n", string(data))
+}
@@ -0,0 +1,138 @@
+package agentfunctions
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	"github.com/MythicAgents/forgescript/pkg/manifest"
+)
+
+const (
+	// File in a registry export listing the exported bundles
+	exportIndexFile = "forgescript-export.json"
+
+	// Directory in a registry export containing the files of each bundle
+	exportBundlesDir = "bundles"
+
+	exportFormatVersion = 1
+)
+
+// A bundle in a registry export
+type exportedBundle struct {
+	Name         string             `json:"name"`
+	FileID       string             `json:"file_id"`
+	FileName     string             `json:"file_name"`
+	SHA256       string             `json:"sha256"`
+	Signer       string             `json:"signer,omitempty"`
+	Script       string             `json:"script"`
+	EntryScripts []string           `json:"entry_scripts"`
+	Manifest     *manifest.Manifest `json:"manifest,omitempty"`
+	Operator     string             `json:"operator"`
+	LoadedAt     time.Time          `json:"loaded_at"`
+	Aliases      []string           `json:"aliases"`
+
+	// SHA-256 hash of every bundle file keyed by path, recorded when the bundle was
+	// loaded. The imported bundle is repacked so its files are checked against these
+	// instead of the digest of the uploaded bundle
+	FileHashes map[string]string `json:"file_hashes"`
+
+	// Directory in the export containing the bundle files
+	Path string `json:"path"`
+}
+
+type registryExport struct {
+	Version    int              `json:"version"`
+	ExportedAt time.Time        `json:"exported_at"`
+	Bundles    []exportedBundle `json:"bundles"`
+}
+
+// Writes every bundle in the saved registry along with its files to a .tar.gz archive
+// which can be imported with forgescript_import. Bundles run from their archive in
+// memory have no files on disk and are skipped, as are bundles whose files changed
+// since they were loaded.
+// Returns the names of the exported bundles and the reasons the other bundles were
+// skipped
+func ExportRegistry(w io.Writer) ([]string, []string, error) {
+	saved, err := readSavedRegistry()
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read alias registry %w", err)
+	}
+
+	gzipw := gzip.NewWriter(w)
+	tarw := tar.NewWriter(gzipw)
+
+	index := registryExport{
+		Version:    exportFormatVersion,
+		ExportedAt: time.Now().UTC(),
+		Bundles:    []exportedBundle{},
+	}
+
+	exported := []string{}
+	skipped := []string{}
+	for _, bundle := range saved.Bundles {
+		if bundle.Packed {
+			skipped = append(skipped, fmt.Sprintf("%s is run from its archive in memory", bundle.Name))
+			continue
+		} else if err := checkBundleIntegrity(bundle.ExtractPath, bundle.FileHashes); err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s %s", bundle.Name, err.Error()))
+			continue
+		}
+
+		aliasNames := make([]string, 0, len(bundle.Aliases))
+		for _, alias := range bundle.Aliases {
+			aliasNames = append(aliasNames, alias.Command.Name)
+		}
+
+		bundlePath := path.Join(exportBundlesDir, fmt.Sprintf("%d", len(index.Bundles)))
+		if err := writeBundleDir(tarw, bundle.ExtractPath, bundlePath); err != nil {
+			return nil, nil, fmt.Errorf("could not export bundle %s %w", bundle.Name, err)
+		}
+
+		index.Bundles = append(index.Bundles, exportedBundle{
+			Name:         bundle.Name,
+			FileID:       bundle.FileID,
+			FileName:     bundle.FileName,
+			SHA256:       bundle.SHA256,
+			Signer:       bundle.Signer,
+			Script:       bundle.Script,
+			EntryScripts: bundle.entryScripts(),
+			Manifest:     bundle.Manifest,
+			Operator:     bundle.Operator,
+			LoadedAt:     bundle.LoadedAt,
+			Aliases:      aliasNames,
+			FileHashes:   bundle.FileHashes,
+			Path:         bundlePath,
+		})
+
+		exported = append(exported, bundle.Name)
+	}
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := tarw.WriteHeader(&tar.Header{
+		Name:     exportIndexFile,
+		Typeflag: tar.TypeReg,
+		Mode:     0644,
+		Size:     int64(len(data)),
+	}); err != nil {
+		return nil, nil, err
+	}
+
+	if _, err := tarw.Write(data); err != nil {
+		return nil, nil, err
+	}
+
+	if err := tarw.Close(); err != nil {
+		return nil, nil, err
+	}
+
+	return exported, skipped, gzipw.Close()
+}
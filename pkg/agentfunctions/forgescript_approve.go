@@ -0,0 +1,88 @@
+package agentfunctions
+
+import (
+	"fmt"
+
+	"github.com/MythicAgents/forgescript/pkg/policy"
+	agentstructs "github.com/MythicMeta/MythicContainer/agent_structs"
+	"github.com/MythicMeta/MythicContainer/logging"
+	"github.com/MythicMeta/MythicContainer/mythicrpc"
+)
+
+func init() {
+	addBuiltinCommand(agentstructs.Command{
+		Name:              fmt.Sprintf("%s_approve", payloadName),
+		HelpString:        fmt.Sprintf("%s_approve -bundle <file id>", payloadName),
+		Description:       "Activate the aliases of a forgescript bundle loaded by another operator",
+		Version:           1,
+		Author:            "@M_alphaaa",
+		ScriptOnlyCommand: true,
+		CommandAttributes: agentstructs.CommandAttribute{
+			SupportedOS:      supportedOSList,
+			CommandIsBuiltin: true,
+		},
+		CommandParameters: []agentstructs.CommandParameter{
+			{
+				Name:             "bundle",
+				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_STRING,
+				Description:      "The file ID of the bundle to approve",
+				ModalDisplayName: "Bundle file ID",
+				ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
+					{
+						ParameterIsRequired: true,
+						UIModalPosition:     1,
+					},
+				},
+			},
+		},
+		TaskFunctionCreateTasking: func(taskData *agentstructs.PTTaskMessageAllData) agentstructs.PTTaskCreateTaskingMessageResponse {
+			response := agentstructs.PTTaskCreateTaskingMessageResponse{
+				TaskID: taskData.Task.ID,
+			}
+
+			if err := checkTaskPolicy(taskData, policy.ActionApprove, ""); err != nil {
+				response.Error = err.Error()
+				return response
+			}
+
+			fileId, _ := taskData.Args.GetStringArg("bundle")
+			response.DisplayParams = new(string)
+			*response.DisplayParams = fmt.Sprintf("-bundle %s", fileId)
+
+			bundle, err := approveBundle(fileId, taskData.Task.OperatorUsername)
+			if bundle == nil {
+				response.Error = err.Error()
+				return response
+			} else if err != nil {
+				logging.LogError(err, "could not save alias registry")
+				response.Error = err.Error()
+			}
+
+			outputResponse := fmt.Sprintf("Approved bundle %s (%s) loaded by %s", bundle.FileName, bundle.FileID, bundle.Operator)
+			for _, alias := range bundle.Aliases {
+				outputResponse += fmt.Sprintf("\nActivated alias %s", alias.Command.Name)
+			}
+
+			if len(response.Error) > 0 {
+				outputResponse += "\n" + response.Error
+			}
+
+			mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
+				TaskID:   taskData.Task.ID,
+				Response: []byte(outputResponse),
+			})
+
+			response.Success = len(response.Error) == 0
+			return response
+		},
+		TaskFunctionParseArgString: func(args *agentstructs.PTTaskMessageArgsData, input string) error {
+			if len(input) > 0 {
+				return args.LoadArgsFromJSONString(input)
+			}
+			return nil
+		},
+		TaskFunctionParseArgDictionary: func(args *agentstructs.PTTaskMessageArgsData, input map[string]interface{}) error {
+			return args.LoadArgsFromDictionary(input)
+		},
+	})
+}
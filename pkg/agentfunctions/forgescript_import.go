@@ -0,0 +1,258 @@
+package agentfunctions
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/MythicAgents/forgescript/pkg/config"
+	"github.com/MythicAgents/forgescript/pkg/extract"
+	"github.com/MythicAgents/forgescript/pkg/policy"
+	agentstructs "github.com/MythicMeta/MythicContainer/agent_structs"
+	"github.com/MythicMeta/MythicContainer/logging"
+	"github.com/MythicMeta/MythicContainer/mythicrpc"
+	"github.com/MythicMeta/MythicContainer/rabbitmq"
+)
+
+// Extracts a registry export and loads each exported bundle. Bundles are verified and
+// loaded like uploaded bundles and a bundle which fails to load does not stop the rest.
+// Returns a line describing the result for each bundle. The error wraps
+// errAliasesNotSaved if the aliases of an imported bundle could not be saved
+func importRegistry(taskData *agentstructs.PTTaskMessageAllData, exportFileID string, exportFileName string, content []byte) ([]string, error) {
+	exportExtractor, err := extract.NewBundleExtractor(bytes.NewReader(content), int64(len(content)), exportFileName, config.GetBundleLimits())
+	if err != nil {
+		return nil, fmt.Errorf("could not read registry export %w", err)
+	}
+
+	runtimePath := config.GetAndCreateForgeScriptRuntimePath()
+	importPath, err := os.MkdirTemp(runtimePath, "import-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(importPath)
+
+	root, err := os.OpenRoot(importPath)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+
+	if _, err := exportExtractor.ExtractTo(root); err != nil {
+		return nil, fmt.Errorf("could not extract registry export %w", err)
+	}
+
+	data, err := fs.ReadFile(root.FS(), exportIndexFile)
+	if err != nil {
+		return nil, fmt.Errorf("file is not a forgescript registry export (%s not found)", exportIndexFile)
+	}
+
+	index := registryExport{}
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("could not parse %s %w", exportIndexFile, err)
+	} else if index.Version != exportFormatVersion {
+		return nil, fmt.Errorf("unsupported registry export version %d", index.Version)
+	}
+
+	lines := []string{}
+	var saveErr error
+	for i, exported := range index.Bundles {
+		bundle, err := importBundle(taskData, fmt.Sprintf("%s/%d", exportFileID, i), importPath, exported)
+		if bundle == nil {
+			logging.LogError(err, "could not import bundle", "name", exported.Name, "sha256", exported.SHA256)
+			lines = append(lines, fmt.Sprintf("Failed importing bundle %s: %s", exported.Name, err.Error()))
+			continue
+		} else if err != nil {
+			saveErr = err
+		}
+
+		aliasNames := []string{}
+		for _, alias := range bundle.Aliases {
+			aliasNames = append(aliasNames, alias.Command.Name)
+		}
+
+		line := fmt.Sprintf("Imported bundle %s as file ID %s with aliases %s", bundle.Name, bundle.FileID, strings.Join(aliasNames, ", "))
+		line += fmt.Sprintf("\n  Exported from file ID %s (sha256 %s), now sha256 %s", exported.FileID, exported.SHA256, bundle.SHA256)
+		for _, name := range exported.Aliases {
+			if !slices.ContainsFunc(bundle.Aliases, func(alias RegisteredAlias) bool {
+				return alias.Command.Name == name || alias.CallbackName() == name
+			}) {
+				line += fmt.Sprintf("\n  Alias %s from the export was not registered", name)
+			}
+		}
+
+		if bundle.PendingApproval {
+			line += fmt.Sprintf("\n  Waiting for approval with %s_approve -bundle %s", payloadName, bundle.FileID)
+		}
+
+		if err != nil {
+			line += "\n  " + err.Error()
+		}
+
+		lines = append(lines, line)
+	}
+
+	return lines, saveErr
+}
+
+// Loads a single bundle from an extracted registry export.
+// Returns the loaded bundle or the bundle already loaded with the same contents. The
+// bundle is also returned with an error wrapping errAliasesNotSaved if its aliases
+// were registered but could not be saved
+func importBundle(taskData *agentstructs.PTTaskMessageAllData, fileID string, importPath string, exported exportedBundle) (*RegisteredBundle, error) {
+	if !filepath.IsLocal(exported.Path) {
+		return nil, fmt.Errorf("bundle path %s is outside of the export", exported.Path)
+	}
+
+	// The repacked bundle has a different digest than the exported one, so its files
+	// are checked against the hashes recorded when the exported bundle was loaded
+	bundleDir := path.Join(importPath, exported.Path)
+	if len(exported.FileHashes) == 0 {
+		return nil, errors.New("export does not contain the file hashes of the bundle")
+	} else if err := checkBundleIntegrity(bundleDir, exported.FileHashes); err != nil {
+		return nil, fmt.Errorf("bundle does not match the export %w", err)
+	}
+
+	content, err := archiveBundleDir(bundleDir)
+	if err != nil {
+		return nil, err
+	}
+
+	fileExtractor, err := extract.NewBundleExtractor(bytes.NewReader(content), int64(len(content)), exported.FileName, config.GetBundleLimits())
+	if err != nil {
+		return nil, fmt.Errorf("could not create bundle extractor %w", err)
+	}
+
+	bundle := &RegisteredBundle{
+		Name:     exported.Name,
+		FileID:   fileID,
+		FileName: exported.FileName,
+		SHA256:   bundleDigest(content, fileExtractor),
+		Script:   exported.Script,
+		Operator: taskData.Task.OperatorUsername,
+		TaskID:   taskData.Task.ID,
+		LoadedAt: time.Now().UTC(),
+
+		PendingApproval: config.GetRequireApproval(),
+	}
+
+	if err := loadBundle(bundle, fileExtractor, content, taskData.Callback.ID, taskData.Task.ID, ""); err != nil {
+		return nil, err
+	}
+
+	if loaded := skipIdenticalBundleLoad(taskData.Task.ID); loaded != nil {
+		return loaded, nil
+	}
+
+	_, saveErr := commitBundleLoad(taskData.Task.ID)
+	if saveErr != nil {
+		logging.LogError(saveErr, "could not save bundle to the alias registry", "file_id", fileID)
+	}
+
+	auditBundleLoad(taskData, bundle)
+
+	if len(bundle.Aliases) == 0 {
+		return nil, errors.New("bundle did not register any aliases")
+	}
+
+	return bundle, saveErr
+}
+
+func init() {
+	addBuiltinCommand(agentstructs.Command{
+		Name:        fmt.Sprintf("%s_import", payloadName),
+		HelpString:  fmt.Sprintf("%s_import [popup]", payloadName),
+		Description: "Load every bundle from a registry export created with `forgescript export`",
+		Version:     1,
+		SupportedUIFeatures: []string{
+			fmt.Sprintf("%s:import", payloadName),
+		},
+		Author:            "@M_alphaaa",
+		ScriptOnlyCommand: true,
+		CommandAttributes: agentstructs.CommandAttribute{
+			SupportedOS:      supportedOSList,
+			CommandIsBuiltin: true,
+		},
+		CommandParameters: []agentstructs.CommandParameter{
+			{
+				Name:             "export",
+				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_FILE,
+				Description:      "The registry export to import",
+				ModalDisplayName: "Registry export (.tar.gz)",
+				ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
+					{
+						ParameterIsRequired: true,
+						UIModalPosition:     1,
+					},
+				},
+			},
+		},
+		TaskFunctionCreateTasking: func(taskData *agentstructs.PTTaskMessageAllData) agentstructs.PTTaskCreateTaskingMessageResponse {
+			response := agentstructs.PTTaskCreateTaskingMessageResponse{
+				TaskID: taskData.Task.ID,
+			}
+
+			if err := checkTaskPolicy(taskData, policy.ActionLoad, ""); err != nil {
+				response.Error = err.Error()
+				return response
+			}
+
+			fileId, err := taskData.Args.GetFileArg("export")
+			if err != nil {
+				logging.LogError(err, "failed to get registry export")
+				response.Error = err.Error()
+				return response
+			}
+
+			fileName, content, err := fetchBundleFile(taskData, fileId)
+			if err != nil {
+				response.Error = err.Error()
+				return response
+			}
+
+			displayParams := fmt.Sprintf("-export %s", fileName)
+			response.DisplayParams = &displayParams
+
+			// Bundles whose aliases were registered but not saved are still reported
+			lines, err := importRegistry(taskData, fileId, fileName, content)
+			if err != nil && !errors.Is(err, errAliasesNotSaved) {
+				logging.LogError(err, "could not import registry export", "file_id", fileId)
+				response.Error = err.Error()
+				return response
+			} else if err != nil {
+				response.Error = err.Error()
+			}
+
+			outputResponse := "Registry export does not contain any bundles"
+			if len(lines) > 0 {
+				outputResponse = strings.Join(lines, "\n")
+			}
+
+			mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
+				TaskID:   taskData.Task.ID,
+				Response: []byte(outputResponse),
+			})
+
+			rabbitmq.SyncPayloadData(&payloadDefinition.Name, false)
+
+			response.Success = err == nil
+			return response
+		},
+		TaskFunctionParseArgString: func(args *agentstructs.PTTaskMessageArgsData, input string) error {
+			if len(input) > 0 {
+				return args.LoadArgsFromJSONString(input)
+			}
+			return nil
+		},
+		TaskFunctionParseArgDictionary: func(args *agentstructs.PTTaskMessageArgsData, input map[string]interface{}) error {
+			return args.LoadArgsFromDictionary(input)
+		},
+	})
+}
@@ -0,0 +1,100 @@
+package agentfunctions
+
+import (
+	"cmp"
+	"fmt"
+	"strings"
+	"time"
+
+	agentstructs "github.com/MythicMeta/MythicContainer/agent_structs"
+	"github.com/MythicMeta/MythicContainer/mythicrpc"
+)
+
+func formatBundleListing(bundle RegisteredBundle) string {
+	aliasNames := make([]string, 0, len(bundle.Aliases))
+	for _, alias := range bundle.Aliases {
+		aliasNames = append(aliasNames, alias.Command.Name)
+	}
+
+	version := "(no manifest)"
+	if bundle.Manifest != nil {
+		version = bundle.Manifest.Version
+	}
+
+	status := "active"
+	if bundle.PendingApproval {
+		status = "waiting for approval"
+	} else if len(bundle.ApprovedBy) > 0 {
+		status = fmt.Sprintf("approved by %s", bundle.ApprovedBy)
+	}
+
+	storage := bundle.ExtractPath
+	if bundle.Packed {
+		storage = "(archive in memory)"
+	}
+
+	lines := []string{
+		fmt.Sprintf("Bundle %s", bundle.FileName),
+		fmt.Sprintf("  Name:      %s", bundle.Name),
+		fmt.Sprintf("  Version:   %s", version),
+		fmt.Sprintf("  File ID:   %s", bundle.FileID),
+		fmt.Sprintf("  SHA-256:   %s", bundle.SHA256),
+		fmt.Sprintf("  Signer:    %s", cmp.Or(bundle.Signer, "(unsigned)")),
+		fmt.Sprintf("  Scripts:   %s", strings.Join(bundle.entryScripts(), ", ")),
+		fmt.Sprintf("  Storage:   %s", storage),
+		fmt.Sprintf("  Operator:  %s", bundle.Operator),
+		fmt.Sprintf("  Status:    %s", status),
+		fmt.Sprintf("  Task ID:   %d", bundle.TaskID),
+		fmt.Sprintf("  Loaded at: %s", bundle.LoadedAt.Format(time.RFC3339)),
+		fmt.Sprintf("  Aliases:   %s", strings.Join(aliasNames, ", ")),
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func init() {
+	addBuiltinCommand(agentstructs.Command{
+		Name:              fmt.Sprintf("%s_list", payloadName),
+		HelpString:        fmt.Sprintf("%s_list", payloadName),
+		Description:       "List the loaded forgescript bundles and their registered aliases",
+		Version:           1,
+		Author:            "@M_alphaaa",
+		ScriptOnlyCommand: true,
+		CommandAttributes: agentstructs.CommandAttribute{
+			SupportedOS:      supportedOSList,
+			CommandIsBuiltin: true,
+		},
+		CommandParameters: []agentstructs.CommandParameter{},
+		TaskFunctionCreateTasking: func(taskData *agentstructs.PTTaskMessageAllData) agentstructs.PTTaskCreateTaskingMessageResponse {
+			response := agentstructs.PTTaskCreateTaskingMessageResponse{
+				TaskID: taskData.Task.ID,
+			}
+
+			bundles := loadedBundles()
+
+			listings := make([]string, 0, len(bundles))
+			for _, bundle := range bundles {
+				listings = append(listings, formatBundleListing(bundle))
+			}
+
+			outputResponse := "No bundles loaded"
+			if len(listings) > 0 {
+				outputResponse = strings.Join(listings, "\n\n")
+			}
+
+			mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
+				TaskID:   taskData.Task.ID,
+				Response: []byte(outputResponse),
+			})
+
+			response.Success = true
+			return response
+		},
+		TaskFunctionParseArgString: func(args *agentstructs.PTTaskMessageArgsData, input string) error {
+			return nil
+		},
+		TaskFunctionParseArgDictionary: func(args *agentstructs.PTTaskMessageArgsData, input map[string]interface{}) error {
+			return nil
+		},
+	})
+}
@@ -1,14 +1,17 @@
 package agentfunctions
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path"
-	"slices"
+	"time"
 
 	"github.com/MythicAgents/forgescript/pkg/config"
 	"github.com/MythicAgents/forgescript/pkg/extract"
+	"github.com/MythicAgents/forgescript/pkg/policy"
 	"github.com/MythicAgents/forgescript/pkg/python"
 	agentstructs "github.com/MythicMeta/MythicContainer/agent_structs"
 	"github.com/MythicMeta/MythicContainer/logging"
@@ -16,11 +19,256 @@ import (
 	"github.com/MythicMeta/MythicContainer/rabbitmq"
 )
 
+// Returns the file name and contents of the file uploaded to Mythic with the file ID
+func fetchBundleFile(taskData *agentstructs.PTTaskMessageAllData, fileId string) (string, []byte, error) {
+	fileSearchResp, err := mythicrpc.SendMythicRPCFileSearch(mythicrpc.MythicRPCFileSearchMessage{
+		TaskID:          taskData.Task.ID,
+		CallbackID:      taskData.Callback.ID,
+		LimitByCallback: true,
+		AgentFileID:     fileId,
+		MaxResults:      1,
+	})
+	if err != nil {
+		logging.LogError(err, "failed getting file information for file ID", "file_id", fileId)
+		return "", nil, err
+	} else if !fileSearchResp.Success {
+		logging.LogError(errors.New(fileSearchResp.Error), "file search RPC call returned an error", "file_id", fileId)
+		return "", nil, errors.New(fileSearchResp.Error)
+	}
+
+	fileContentResponse, err := mythicrpc.SendMythicRPCFileGetContent(mythicrpc.MythicRPCFileGetContentMessage{
+		AgentFileID: fileId,
+	})
+	if err != nil {
+		logging.LogError(err, "failed getting bundle content for file ID", "file_id", fileId)
+		return "", nil, err
+	} else if !fileContentResponse.Success {
+		logging.LogError(errors.New(fileContentResponse.Error), "file get content response for bundle returned an error", "file_id", fileId)
+		return "", nil, errors.New(fileContentResponse.Error)
+	}
+
+	return fileSearchResp.Files[0].Filename, fileContentResponse.Content, nil
+}
+
+// Fetches the bundle with the specified file ID from Mythic, extracts it and runs the
+// load script. The aliases registered by the script are staged for the task until
+// commitBundleLoad is called. If replaceFileID is not empty, the staged bundle will
+// replace the loaded bundle with that file ID.
+// Returns nil and sets the response error if the bundle could not be loaded
+func stageBundle(taskData *agentstructs.PTTaskMessageAllData, response *agentstructs.PTTaskCreateTaskingMessageResponse, fileId string, scriptName string, replaceFileID string) *RegisteredBundle {
+	originalFileName, content, err := fetchBundleFile(taskData, fileId)
+	if err != nil {
+		response.Error = err.Error()
+		return nil
+	}
+
+	if response.DisplayParams == nil {
+		response.DisplayParams = new(string)
+	}
+
+	*response.DisplayParams = fmt.Sprintf("-bundle %s -script %s", originalFileName, scriptName)
+
+	fileExtractor, err := extract.NewBundleExtractor(bytes.NewReader(content), int64(len(content)), originalFileName, config.GetBundleLimits())
+	if err != nil {
+		logging.LogError(err, "could not create bundle extractor")
+		response.Error = fmt.Sprintf("could not create bundle extractor %s", err.Error())
+		return nil
+	}
+
+	// A bare Python script is a bundle with the script as its only file
+	if scriptExtractor, ok := fileExtractor.(extract.ScriptExtractor); ok {
+		scriptName = scriptExtractor.ScriptName()
+		*response.DisplayParams = fmt.Sprintf("-bundle %s -script %s", originalFileName, scriptName)
+	}
+
+	bundle := &RegisteredBundle{
+		Name:     bundleNameFromFile(originalFileName),
+		FileID:   fileId,
+		FileName: originalFileName,
+		SHA256:   bundleDigest(content, fileExtractor),
+		Script:   scriptName,
+		Operator: taskData.Task.OperatorUsername,
+		TaskID:   taskData.Task.ID,
+		LoadedAt: time.Now().UTC(),
+
+		PendingApproval: config.GetRequireApproval(),
+	}
+
+	if err := loadBundle(bundle, fileExtractor, content, taskData.Callback.ID, taskData.Task.ID, replaceFileID); err != nil {
+		response.Error = err.Error()
+
+		scriptErr := bundleScriptError{}
+		if errors.As(err, &scriptErr) {
+			mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
+				TaskID:   taskData.Task.ID,
+				Response: []byte(scriptErr.err.Error()),
+			})
+		}
+
+		return nil
+	}
+
+	// The manifest replaces the script parameter if the bundle has one
+	if bundle.Manifest != nil {
+		*response.DisplayParams = fmt.Sprintf("-bundle %s", originalFileName)
+	}
+
+	return bundle
+}
+
+// Returned when an entry script of a bundle fails to run
+type bundleScriptError struct {
+	script string
+	err    error
+}
+
+func (e bundleScriptError) Error() string {
+	return fmt.Sprintf("failed loading script %s %s", e.script, e.err.Error())
+}
+
+func (e bundleScriptError) Unwrap() error {
+	return e.err
+}
+
+// Extracts the bundle contents, or opens them in place when running from the archive,
+// verifies them and runs the entry scripts of the bundle. The aliases registered by
+// the scripts are staged for the task until commitBundleLoad is called
+func loadBundle(bundle *RegisteredBundle, fileExtractor extract.BundleExtractor, content []byte, callbackID int, taskID int, replaceFileID string) error {
+	var bundleFiles fs.FS
+
+	// Keeps other loads of the same digest from replacing the extraction until this
+	// load is staged
+	unlockExtraction := func() {}
+	defer func() { unlockExtraction() }()
+
+	archiveBundle, packed := fileExtractor.(extract.ArchiveBundle)
+	if packed && config.GetRunFromArchive() {
+		// Zip bundles are run from the archive in memory without being extracted
+		var err error
+		bundleFiles, err = archiveBundle.Open()
+		if err != nil {
+			logging.LogError(err, "could not open bundle archive", "file_id", bundle.FileID, "sha256", bundle.SHA256)
+			return err
+		}
+
+		bundle.Packed = true
+		storePackedArchive(bundle.SHA256, content)
+	} else {
+		var err error
+		bundle.ExtractPath, bundle.reused, unlockExtraction, err = extractBundle(fileExtractor, bundle.SHA256)
+		if err != nil {
+			logging.LogError(err, "could not extract bundle", "file_id", bundle.FileID, "sha256", bundle.SHA256)
+			return err
+		}
+
+		root, err := os.OpenRoot(bundle.ExtractPath)
+		if err != nil {
+			discardBundleFiles(bundle)
+			return err
+		}
+		defer root.Close()
+
+		bundleFiles = root.FS()
+
+		// The hashes are recorded before any code from the bundle is run
+		bundle.FileHashes, err = hashBundleFiles(bundleFiles)
+		if err != nil {
+			logging.LogError(err, "could not hash bundle files", "file_id", bundle.FileID, "path", bundle.ExtractPath)
+			discardBundleFiles(bundle)
+			return err
+		}
+	}
+
+	// The bundle must be verified before any code from it is run
+	signer, err := verifyBundleSignature(bundleFiles)
+	if err != nil {
+		logging.LogError(err, "rejected bundle", "file_id", bundle.FileID, "sha256", bundle.SHA256)
+		discardBundleFiles(bundle)
+		return err
+	}
+
+	bundle.Signer = signer
+
+	// The manifest replaces the script name if the bundle has one
+	bundleManifest, err := loadBundleManifest(bundleFiles)
+	if err != nil {
+		logging.LogError(err, "rejected bundle manifest", "file_id", bundle.FileID, "sha256", bundle.SHA256)
+		discardBundleFiles(bundle)
+		return err
+	} else if bundleManifest != nil {
+		bundle.Manifest = bundleManifest
+		bundle.Name = bundleManifest.Name
+		bundle.Script = bundleManifest.EntryScripts[0]
+	}
+
+	entryScripts := bundle.entryScripts()
+	for _, entryScript := range entryScripts {
+		if err := checkBundleScript(bundleFiles, entryScript); err != nil {
+			discardBundleFiles(bundle)
+			return err
+		}
+	}
+
+	beginBundleLoad(taskID, bundle, replaceFileID)
+	unlockExtraction()
+
+	for _, entryScript := range entryScripts {
+		var interpreter *python.ScriptInterpreter
+		var err error
+		if bundle.Packed {
+			interpreter, err = python.RunArchiveScript(content, packedArchiveName(bundle.SHA256), entryScript, callbackID, taskID, bundle.Operator, bundle.loadTimeout())
+		} else {
+			interpreter, err = python.RunScript(path.Join(bundle.ExtractPath, entryScript), callbackID, taskID, bundle.Operator, bundle.loadTimeout())
+		}
+
+		if err != nil {
+			abortBundleLoad(taskID)
+			discardBundleFiles(bundle)
+			return bundleScriptError{script: entryScript, err: err}
+		}
+
+		// The aliases of the script call the callbacks from this run instead of running
+		// the script again
+		bundle.interpreters = append(bundle.interpreters, interpreter)
+	}
+
+	return nil
+}
+
+// Returns the line describing the bundle name and version from its manifest
+func formatBundleVersion(bundle *RegisteredBundle) string {
+	if bundle.Manifest == nil {
+		return fmt.Sprintf("Bundle %s has no manifest", bundle.Name)
+	}
+
+	return fmt.Sprintf("Bundle %s version %s", bundle.Manifest.Name, bundle.Manifest.Version)
+}
+
+// Returns the line describing whether the aliases of the bundle can be used
+func formatBundleApproval(bundle *RegisteredBundle) string {
+	if bundle.PendingApproval {
+		return fmt.Sprintf("Aliases are inactive until another operator approves the bundle with %s_approve -bundle %s", payloadName, bundle.FileID)
+	} else if len(bundle.ApprovedBy) > 0 {
+		return fmt.Sprintf("Bundle approved by %s", bundle.ApprovedBy)
+	}
+
+	return ""
+}
+
+// Returns the line describing who signed the bundle
+func formatBundleSigner(bundle *RegisteredBundle) string {
+	if len(bundle.Signer) == 0 {
+		return "Bundle is not signed"
+	}
+
+	return fmt.Sprintf("Bundle signed by %s", bundle.Signer)
+}
+
 func init() {
-	agentstructs.AllPayloadData.Get(payloadName).AddCommand(agentstructs.Command{
+	addBuiltinCommand(agentstructs.Command{
 		Name:        fmt.Sprintf("%s_load", payloadName),
 		HelpString:  fmt.Sprintf("%s_load [popup]", payloadName),
-		Description: "Load a forgescript bundle and evaluate the specified script",
+		Description: "Load a forgescript bundle and evaluate its entry scripts",
 		Version:     1,
 		SupportedUIFeatures: []string{
 			fmt.Sprintf("%s:load", payloadName),
@@ -36,7 +284,7 @@ func init() {
 				Name:             "bundle",
 				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_FILE,
 				Description:      "The script bundle to load",
-				ModalDisplayName: "Script bundle (.tar.gz, .zip)",
+				ModalDisplayName: "Script bundle (.tar.gz, .tar.xz, .tar.zst, .zip, .py)",
 				ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
 					{
 						ParameterIsRequired: true,
@@ -47,7 +295,7 @@ func init() {
 			{
 				Name:             "script",
 				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_STRING,
-				Description:      "The path to the script inside the bundle to load",
+				Description:      "The path to the script inside the bundle to load. Ignored if the bundle is a single Python script or has a manifest",
 				DefaultValue:     "forgescript_alias.py",
 				ModalDisplayName: "Load script",
 				ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
@@ -63,115 +311,69 @@ func init() {
 				TaskID: taskData.Task.ID,
 			}
 
-			fileId, err := taskData.Args.GetFileArg("bundle")
-			if err != nil {
-				logging.LogError(err, "failed to get loaded bundle")
+			if err := checkTaskPolicy(taskData, policy.ActionLoad, ""); err != nil {
 				response.Error = err.Error()
 				return response
 			}
 
-			fileSearchResp, err := mythicrpc.SendMythicRPCFileSearch(mythicrpc.MythicRPCFileSearchMessage{
-				TaskID:          taskData.Task.ID,
-				CallbackID:      taskData.Callback.ID,
-				LimitByCallback: true,
-				AgentFileID:     fileId,
-				MaxResults:      1,
-			})
+			fileId, err := taskData.Args.GetFileArg("bundle")
 			if err != nil {
-				logging.LogError(err, "failed getting file information for file ID", "file_id", fileId)
+				logging.LogError(err, "failed to get loaded bundle")
 				response.Error = err.Error()
 				return response
-			} else if !fileSearchResp.Success {
-				logging.LogError(errors.New(fileSearchResp.Error), "file search RPC call returned an error", "file_id", fileId)
-				response.Error = fileSearchResp.Error
-				return response
 			}
 
 			scriptName, _ := taskData.Args.GetStringArg("script")
 
-			originalFileName := fileSearchResp.Files[0].Filename
-			if response.DisplayParams == nil {
-				response.DisplayParams = new(string)
-			}
-
-			*response.DisplayParams = fmt.Sprintf("-bundle %s -script %s", originalFileName, scriptName)
-
-			fileContentResponse, err := mythicrpc.SendMythicRPCFileGetContent(mythicrpc.MythicRPCFileGetContentMessage{
-				AgentFileID: fileId,
-			})
-			if err != nil {
-				logging.LogError(err, "failed getting bundle content for file ID", "file_id", fileId)
-				response.Error = err.Error()
-				return response
-			} else if !fileContentResponse.Success {
-				logging.LogError(errors.New(fileContentResponse.Error), "file get content response for bundle returned an error", "file_id", fileId)
-				response.Error = fileContentResponse.Error
+			bundle := stageBundle(taskData, &response, fileId, scriptName, "")
+			if bundle == nil {
 				return response
 			}
 
-			fileExtractor, err := extract.NewBundleExtractor(fileContentResponse.Content)
-			if err != nil {
-				logging.LogError(err, "could not create bundle extractor")
-				response.Error = fmt.Sprintf("could not create bundle extractor %s", err.Error())
-				return response
-			}
+			if loaded := skipIdenticalBundleLoad(taskData.Task.ID); loaded != nil {
+				outputResponse := fmt.Sprintf("Bundle %s (sha256 %s) is already loaded from file %s. No aliases were changed", bundle.FileName, bundle.SHA256, loaded.FileID)
+				for _, alias := range loaded.Aliases {
+					outputResponse += fmt.Sprintf("\nAlias %s is already registered", alias.Command.Name)
+				}
 
-			bundleFiles, err := fileExtractor.ListFilePaths()
-			if err != nil {
-				logging.LogError(err, "could not list files in bundle")
-				response.Error = fmt.Sprintf("could not list files in bundle %s", err.Error())
-				return response
-			}
+				mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
+					TaskID:   taskData.Task.ID,
+					Response: []byte(outputResponse),
+				})
 
-			if !slices.Contains(bundleFiles, scriptName) {
-				response.Error = fmt.Sprintf("script '%s' not found in bundle", scriptName)
+				response.Success = true
 				return response
 			}
 
-			extractPath := path.Join(config.GetForgeScriptRuntimePath(), fileId)
-
-			if err := os.MkdirAll(extractPath, 0700); err != nil {
-				logging.LogError(err, "could not create path for extracted bundle")
-				response.Error = fmt.Sprintf("could not create path for extracted bundle %s", err.Error())
-				return response
+			if _, err := commitBundleLoad(taskData.Task.ID); err != nil {
+				logging.LogError(err, "could not save bundle to the alias registry", "file_id", fileId)
+				response.Error = err.Error()
 			}
 
-			extractDir, err := os.OpenRoot(extractPath)
-			if err != nil {
-				logging.LogError(err, "could not open extract path")
-				response.Error = fmt.Sprintf("could not open path for extracting the bundle %s", err.Error())
-				return response
-			}
+			auditBundleLoad(taskData, bundle)
 
-			if err := fileExtractor.ExtractTo(extractDir); err != nil {
-				logging.LogError(err, "could not extract bundle")
-				response.Error = fmt.Sprintf("could not extract bundle %s", err.Error())
-				return response
+			// A bundle without aliases is not kept and its files were already released
+			outputResponse := fmt.Sprintf("Extracted bundle to %s", bundle.ExtractPath)
+			if len(bundle.Aliases) == 0 {
+				outputResponse = "Bundle did not register any aliases and was not kept"
+			} else if bundle.Packed {
+				outputResponse = "Running bundle from its archive in memory"
+			} else if bundle.reused {
+				outputResponse = fmt.Sprintf("Using existing extraction of bundle at %s", bundle.ExtractPath)
 			}
 
-			scriptFullPath := path.Join(extractPath, scriptName)
-			if scriptStat, err := os.Stat(scriptFullPath); err != nil {
-				logging.LogError(err, fmt.Sprintf("could not find %s in extracted bundle", scriptFullPath))
-				response.Error = fmt.Sprintf("could not find %s in extracted bundle", scriptFullPath)
-				return response
-			} else if scriptStat.IsDir() {
-				response.Error = "specified path for bundle script is a directory"
-				return response
+			outputResponse += "\n" + formatBundleVersion(bundle)
+			outputResponse += "\n" + formatBundleSigner(bundle)
+			if approval := formatBundleApproval(bundle); len(approval) > 0 {
+				outputResponse += "\n" + approval
 			}
 
-			registered, err := python.RunScript(scriptFullPath, taskData.Callback.ID, taskData.Task.ID, taskData.Task.OperatorUsername)
-			if err != nil {
-				response.Error = fmt.Sprintf("failed loading script %s", err.Error())
-				mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
-					TaskID:   taskData.Task.ID,
-					Response: []byte(err.Error()),
-				})
-				return response
+			for _, alias := range bundle.Aliases {
+				outputResponse += fmt.Sprintf("\nRegistered alias %s", alias.Command.Name)
 			}
 
-			outputResponse := fmt.Sprintf("Extracted bundle to %s", extractPath)
-			for _, aliasName := range registered {
-				outputResponse += fmt.Sprintf("\nRegistered alias %s", aliasName)
+			if len(response.Error) > 0 {
+				outputResponse += "\n" + response.Error
 			}
 
 			mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
@@ -181,7 +383,7 @@ func init() {
 
 			rabbitmq.SyncPayloadData(&payloadDefinition.Name, false)
 
-			response.Success = true
+			response.Success = len(response.Error) == 0
 			return response
 		},
 		TaskFunctionParseArgString: func(args *agentstructs.PTTaskMessageArgsData, input string) error {
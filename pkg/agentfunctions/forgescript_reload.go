@@ -0,0 +1,151 @@
+package agentfunctions
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/MythicAgents/forgescript/pkg/policy"
+	agentstructs "github.com/MythicMeta/MythicContainer/agent_structs"
+	"github.com/MythicMeta/MythicContainer/logging"
+	"github.com/MythicMeta/MythicContainer/mythicrpc"
+	"github.com/MythicMeta/MythicContainer/rabbitmq"
+)
+
+func init() {
+	addBuiltinCommand(agentstructs.Command{
+		Name:        fmt.Sprintf("%s_reload", payloadName),
+		HelpString:  fmt.Sprintf("%s_reload [popup]", payloadName),
+		Description: "Replace the aliases of a loaded forgescript bundle with a new version of the bundle",
+		Version:     1,
+		SupportedUIFeatures: []string{
+			fmt.Sprintf("%s:reload", payloadName),
+		},
+		Author:            "@M_alphaaa",
+		ScriptOnlyCommand: true,
+		CommandAttributes: agentstructs.CommandAttribute{
+			SupportedOS:      supportedOSList,
+			CommandIsBuiltin: true,
+		},
+		CommandParameters: []agentstructs.CommandParameter{
+			{
+				Name:             "target",
+				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_STRING,
+				Description:      "The file ID of the loaded bundle to replace",
+				ModalDisplayName: "Loaded bundle file ID",
+				ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
+					{
+						ParameterIsRequired: true,
+						UIModalPosition:     1,
+					},
+				},
+			},
+			{
+				Name:             "bundle",
+				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_FILE,
+				Description:      "The new version of the script bundle",
+				ModalDisplayName: "Script bundle (.tar.gz, .tar.xz, .tar.zst, .zip, .py)",
+				ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
+					{
+						ParameterIsRequired: true,
+						UIModalPosition:     2,
+					},
+				},
+			},
+			{
+				Name:             "script",
+				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_STRING,
+				Description:      "The path to the script inside the bundle to load. Ignored if the bundle is a single Python script or has a manifest",
+				DefaultValue:     "forgescript_alias.py",
+				ModalDisplayName: "Load script",
+				ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
+					{
+						ParameterIsRequired: true,
+						UIModalPosition:     3,
+					},
+				},
+			},
+		},
+		TaskFunctionCreateTasking: func(taskData *agentstructs.PTTaskMessageAllData) agentstructs.PTTaskCreateTaskingMessageResponse {
+			response := agentstructs.PTTaskCreateTaskingMessageResponse{
+				TaskID: taskData.Task.ID,
+			}
+
+			// Reloading unregisters the aliases of the bundle being replaced so the
+			// operator must also be allowed to unload
+			for _, action := range []string{policy.ActionLoad, policy.ActionUnload} {
+				if err := checkTaskPolicy(taskData, action, ""); err != nil {
+					response.Error = err.Error()
+					return response
+				}
+			}
+
+			targetId, _ := taskData.Args.GetStringArg("target")
+			if !slices.ContainsFunc(loadedBundles(), func(bundle RegisteredBundle) bool {
+				return bundle.FileID == targetId
+			}) {
+				response.Error = fmt.Sprintf("bundle '%s' is not loaded", targetId)
+				return response
+			}
+
+			fileId, err := taskData.Args.GetFileArg("bundle")
+			if err != nil {
+				logging.LogError(err, "failed to get loaded bundle")
+				response.Error = err.Error()
+				return response
+			}
+
+			scriptName, _ := taskData.Args.GetStringArg("script")
+
+			bundle := stageBundle(taskData, &response, fileId, scriptName, targetId)
+			if bundle == nil {
+				return response
+			}
+
+			*response.DisplayParams = fmt.Sprintf("-target %s %s", targetId, *response.DisplayParams)
+
+			previous, err := commitBundleLoad(taskData.Task.ID)
+			if previous == nil {
+				response.Error = fmt.Sprintf("could not replace bundle %s", err.Error())
+				discardBundleFiles(bundle)
+
+				return response
+			} else if err != nil {
+				logging.LogError(err, "could not save bundle to the alias registry", "file_id", fileId)
+				response.Error = err.Error()
+			}
+
+			auditBundleLoad(taskData, bundle)
+
+			outputResponse := fmt.Sprintf("Replaced bundle %s (%s) with %s (%s)\n", previous.FileName, previous.FileID, bundle.FileName, bundle.FileID)
+			outputResponse += formatBundleVersion(bundle) + "\n"
+			outputResponse += formatBundleSigner(bundle) + "\n"
+			if approval := formatBundleApproval(bundle); len(approval) > 0 {
+				outputResponse += approval + "\n"
+			}
+
+			outputResponse += formatAliasDiff(previous.Aliases, bundle.Aliases)
+			if len(response.Error) > 0 {
+				outputResponse += "\n" + response.Error
+			}
+
+			mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
+				TaskID:   taskData.Task.ID,
+				Response: []byte(outputResponse),
+			})
+
+			rabbitmq.SyncPayloadData(&payloadDefinition.Name, false)
+
+			response.Success = len(response.Error) == 0
+			return response
+		},
+		TaskFunctionParseArgString: func(args *agentstructs.PTTaskMessageArgsData, input string) error {
+			if len(input) > 0 {
+				return args.LoadArgsFromJSONString(input)
+			}
+			return nil
+		},
+		TaskFunctionParseArgDictionary: func(args *agentstructs.PTTaskMessageArgsData, input map[string]interface{}) error {
+			return args.LoadArgsFromDictionary(input)
+		},
+	})
+}
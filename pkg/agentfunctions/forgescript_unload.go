@@ -0,0 +1,142 @@
+package agentfunctions
+
+import (
+	"fmt"
+
+	"github.com/MythicAgents/forgescript/pkg/policy"
+	agentstructs "github.com/MythicMeta/MythicContainer/agent_structs"
+	"github.com/MythicMeta/MythicContainer/logging"
+	"github.com/MythicMeta/MythicContainer/mythicrpc"
+	"github.com/MythicMeta/MythicContainer/rabbitmq"
+)
+
+func init() {
+	addBuiltinCommand(agentstructs.Command{
+		Name:              fmt.Sprintf("%s_unload", payloadName),
+		HelpString:        fmt.Sprintf("%s_unload -alias <name> | -bundle <file id>", payloadName),
+		Description:       "Remove an alias or every alias registered by a forgescript bundle",
+		Version:           1,
+		Author:            "@M_alphaaa",
+		ScriptOnlyCommand: true,
+		CommandAttributes: agentstructs.CommandAttribute{
+			SupportedOS:      supportedOSList,
+			CommandIsBuiltin: true,
+		},
+		CommandParameters: []agentstructs.CommandParameter{
+			{
+				Name:             "alias",
+				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_STRING,
+				Description:      "The name of the alias to remove",
+				ModalDisplayName: "Alias name",
+				ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
+					{
+						GroupName:           "Alias",
+						ParameterIsRequired: true,
+						UIModalPosition:     1,
+					},
+				},
+			},
+			{
+				Name:             "bundle",
+				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_STRING,
+				Description:      "The file ID of the bundle to remove",
+				ModalDisplayName: "Bundle file ID",
+				ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
+					{
+						GroupName:           "Bundle",
+						ParameterIsRequired: true,
+						UIModalPosition:     1,
+					},
+				},
+			},
+		},
+		TaskFunctionCreateTasking: func(taskData *agentstructs.PTTaskMessageAllData) agentstructs.PTTaskCreateTaskingMessageResponse {
+			response := agentstructs.PTTaskCreateTaskingMessageResponse{
+				TaskID: taskData.Task.ID,
+			}
+
+			if err := checkTaskPolicy(taskData, policy.ActionUnload, ""); err != nil {
+				response.Error = err.Error()
+				return response
+			}
+
+			groupName, err := taskData.Args.GetParameterGroupName()
+			if err != nil {
+				logging.LogError(err, "could not determine parameter group for unload")
+				response.Error = err.Error()
+				return response
+			}
+
+			if response.DisplayParams == nil {
+				response.DisplayParams = new(string)
+			}
+
+			outputResponse := ""
+
+			if groupName == "Bundle" {
+				fileId, _ := taskData.Args.GetStringArg("bundle")
+				*response.DisplayParams = fmt.Sprintf("-bundle %s", fileId)
+
+				bundle, err := unregisterBundle(fileId)
+				if bundle == nil {
+					response.Error = err.Error()
+					return response
+				} else if err != nil {
+					logging.LogError(err, "could not save alias registry")
+					response.Error = err.Error()
+				}
+
+				for _, alias := range bundle.Aliases {
+					outputResponse += fmt.Sprintf("Removed alias %s\n", alias.Command.Name)
+				}
+
+				outputResponse += fmt.Sprintf("Removed bundle %s", bundle.FileID)
+			} else {
+				aliasName, _ := taskData.Args.GetStringArg("alias")
+				*response.DisplayParams = fmt.Sprintf("-alias %s", aliasName)
+
+				if isBuiltinCommand(aliasName) {
+					response.Error = fmt.Sprintf("'%s' is a builtin command and cannot be removed", aliasName)
+					return response
+				}
+
+				bundle, err := unregisterAlias(aliasName)
+				if bundle == nil {
+					response.Error = err.Error()
+					return response
+				} else if err != nil {
+					logging.LogError(err, "could not save alias registry")
+					response.Error = err.Error()
+				}
+
+				outputResponse += fmt.Sprintf("Removed alias %s", aliasName)
+				if len(bundle.Aliases) == 0 {
+					outputResponse += fmt.Sprintf("\nRemoved bundle %s", bundle.FileID)
+				}
+			}
+
+			if len(response.Error) > 0 {
+				outputResponse += "\n" + response.Error
+			}
+
+			mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
+				TaskID:   taskData.Task.ID,
+				Response: []byte(outputResponse),
+			})
+
+			rabbitmq.SyncPayloadData(&payloadDefinition.Name, false)
+
+			response.Success = len(response.Error) == 0
+			return response
+		},
+		TaskFunctionParseArgString: func(args *agentstructs.PTTaskMessageArgsData, input string) error {
+			if len(input) > 0 {
+				return args.LoadArgsFromJSONString(input)
+			}
+			return nil
+		},
+		TaskFunctionParseArgDictionary: func(args *agentstructs.PTTaskMessageArgsData, input map[string]interface{}) error {
+			return args.LoadArgsFromDictionary(input)
+		},
+	})
+}
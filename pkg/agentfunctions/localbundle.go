@@ -0,0 +1,176 @@
+package agentfunctions
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sync/atomic"
+	"time"
+
+	"github.com/MythicAgents/forgescript/pkg/config"
+	"github.com/MythicAgents/forgescript/pkg/extract"
+	"github.com/MythicAgents/forgescript/pkg/policy"
+	"github.com/MythicMeta/MythicContainer/logging"
+)
+
+const (
+	// Operator recorded for bundles loaded from the container filesystem
+	localOperator = "forgescript"
+
+	// Load script used for local bundles without a manifest
+	defaultLoadScript = "forgescript_alias.py"
+)
+
+// Local bundles are not loaded by a Mythic task so their aliases are staged under
+// negative task IDs which Mythic never uses
+var lastLocalTaskID atomic.Int64
+
+func nextLocalTaskID() int {
+	return -int(lastLocalTaskID.Add(1))
+}
+
+// Loads a bundle archive or unpacked bundle directory from the container filesystem.
+// The file ID of the bundle is the prefix followed by the file name. If replaceFileID
+// is not empty, the bundle replaces the loaded bundle with that file ID.
+// Local bundles are checked against the load policy and wait for approval like uploaded
+// bundles.
+// Returns the loaded bundle and the bundle it replaced
+func loadLocalBundle(bundlePath string, fileIDPrefix string, replaceFileID string) (*RegisteredBundle, *RegisteredBundle, error) {
+	if err := checkLocalPolicy(policy.ActionLoad); err != nil {
+		return nil, nil, err
+	}
+
+	info, err := os.Stat(bundlePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var content []byte
+	if info.IsDir() {
+		content, err = archiveBundleDir(bundlePath)
+	} else {
+		content, err = os.ReadFile(bundlePath)
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fileName := path.Base(bundlePath)
+	fileExtractor, err := extract.NewBundleExtractor(bytes.NewReader(content), int64(len(content)), fileName, config.GetBundleLimits())
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not create bundle extractor %w", err)
+	}
+
+	scriptName := defaultLoadScript
+	if scriptExtractor, ok := fileExtractor.(extract.ScriptExtractor); ok {
+		scriptName = scriptExtractor.ScriptName()
+	}
+
+	bundle := &RegisteredBundle{
+		Name:      bundleNameFromFile(fileName),
+		FileID:    fileIDPrefix + fileName,
+		FileName:  fileName,
+		SHA256:    bundleDigest(content, fileExtractor),
+		Script:    scriptName,
+		Operator:  localOperator,
+		LoadedAt:  time.Now().UTC(),
+		LocalPath: bundlePath,
+
+		PendingApproval: config.GetRequireApproval(),
+	}
+
+	taskID := nextLocalTaskID()
+	if err := loadBundle(bundle, fileExtractor, content, 0, taskID, replaceFileID); err != nil {
+		return nil, nil, err
+	}
+
+	if loaded := skipIdenticalBundleLoad(taskID); loaded != nil {
+		logging.LogInfo("Bundle is already loaded", "path", bundlePath, "file_id", loaded.FileID)
+		return loaded, nil, nil
+	}
+
+	previous, err := commitBundleLoad(taskID)
+	if previous == nil && err != nil {
+		discardBundleFiles(bundle)
+		return nil, nil, err
+	} else if err != nil {
+		logging.LogError(err, "could not save bundle to the alias registry", "path", bundlePath)
+	}
+
+	if len(bundle.Aliases) == 0 {
+		return nil, nil, errors.New("bundle did not register any aliases")
+	}
+
+	return bundle, previous, nil
+}
+
+// Packs an unpacked bundle directory into a tar archive so it is checked and extracted
+// like an uploaded bundle
+func archiveBundleDir(bundleDir string) ([]byte, error) {
+	var buf bytes.Buffer
+	tarw := tar.NewWriter(&buf)
+	if err := writeBundleDir(tarw, bundleDir, ""); err != nil {
+		return nil, err
+	}
+
+	if err := tarw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Writes the files of a bundle directory to the tar archive under the prefix. Headers
+// only keep the file names and permissions so the same files always produce the same
+// archive
+func writeBundleDir(tarw *tar.Writer, bundleDir string, prefix string) error {
+	root, err := os.OpenRoot(bundleDir)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+
+	bundleFiles := root.FS()
+	return fs.WalkDir(bundleFiles, ".", func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil || filePath == "." {
+			return err
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		hdr := &tar.Header{
+			Name: path.Join(prefix, filePath),
+			Mode: int64(info.Mode().Perm()),
+		}
+
+		if entry.IsDir() {
+			hdr.Typeflag = tar.TypeDir
+			hdr.Name += "/"
+			return tarw.WriteHeader(hdr)
+		} else if !info.Mode().IsRegular() {
+			return fmt.Errorf("%s in bundle directory is not a regular file", filePath)
+		}
+
+		content, err := fs.ReadFile(bundleFiles, filePath)
+		if err != nil {
+			return err
+		}
+
+		hdr.Typeflag = tar.TypeReg
+		hdr.Size = int64(len(content))
+		if err := tarw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		_, err = tarw.Write(content)
+		return err
+	})
+}
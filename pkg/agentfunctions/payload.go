@@ -4,13 +4,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"slices"
 	"strings"
+	"sync"
 
 	"github.com/MythicAgents/forgescript/pkg/config"
-	"github.com/MythicAgents/forgescript/pkg/python"
+	"github.com/MythicAgents/forgescript/pkg/policy"
 	"github.com/MythicAgents/forgescript/pkg/versioninfo"
 	agentstructs "github.com/MythicMeta/MythicContainer/agent_structs"
 	"github.com/MythicMeta/MythicContainer/logging"
+	"github.com/MythicMeta/MythicContainer/mythicrpc"
+	"github.com/MythicMeta/MythicContainer/rabbitmq"
 	"github.com/MythicMeta/MythicContainer/utils/sharedStructs"
 )
 
@@ -39,6 +43,13 @@ var (
 		agentstructs.SUPPORTED_OS_CHROME,
 		agentstructs.SUPPORTED_OS_WEBSHELL,
 	}
+
+	// Names of the commands built into forgescript
+	builtinCommands = []string{}
+
+	// Number of aliases restored from the registry during initialization
+	restoredAliases = 0
+	restoredSync    sync.Once
 )
 
 func formatDescriptionMetadata() string {
@@ -76,9 +87,23 @@ var payloadDefinition = agentstructs.PayloadType{
 	MythicEncryptsData:     true,
 	AgentType:              agentstructs.AgentTypeCommandAugment,
 	OnContainerStartFunction: func(message sharedStructs.ContainerOnStartMessage) sharedStructs.ContainerOnStartMessageResponse {
-		return sharedStructs.ContainerOnStartMessageResponse{
+		response := sharedStructs.ContainerOnStartMessageResponse{
 			ContainerName: message.ContainerName,
 		}
+
+		if restoredAliases > 0 || preloadedAliases > 0 {
+			restoredSync.Do(func() {
+				syncName := payloadName
+				rabbitmq.SyncPayloadData(&syncName, false)
+			})
+
+			response.EventLogInfoMessage = fmt.Sprintf("Restored %d forgescript aliases", restoredAliases)
+			if preloadedAliases > 0 {
+				response.EventLogInfoMessage += fmt.Sprintf(" and preloaded %d aliases", preloadedAliases)
+			}
+		}
+
+		return response
 	},
 	CheckIfCallbacksAliveFunction: func(message agentstructs.PTCheckIfCallbacksAliveMessage) agentstructs.PTCheckIfCallbacksAliveMessageResponse {
 		return agentstructs.PTCheckIfCallbacksAliveMessageResponse{
@@ -98,17 +123,77 @@ func Initialize() {
 
 	payloadData := agentstructs.AllPayloadData.Get(payloadName)
 	payloadData.AddPayloadDefinition(payloadDefinition)
+
+	restored, err := restoreRegistry()
+	if err != nil {
+		logging.LogError(err, "could not restore alias registry", "registryPath", config.GetForgeScriptRegistryPath())
+	}
+
+	restoredAliases = restored
+	logging.LogInfo("Restored aliases from registry", "count", restoredAliases)
+}
+
+func addBuiltinCommand(command agentstructs.Command) {
+	builtinCommands = append(builtinCommands, command.Name)
+	agentstructs.AllPayloadData.Get(payloadName).AddCommand(command)
+}
+
+func isBuiltinCommand(name string) bool {
+	return slices.Contains(builtinCommands, name)
 }
 
 func AddAliasCommand(scriptPath string, callbackID int, taskID int, command agentstructs.Command) error {
 	logging.LogDebug("Adding alias command", "command", command)
 
+	alias := RegisteredAlias{
+		ScriptPath: scriptPath,
+		Command:    command,
+	}
+
+	// Aliases are only registered through a staged load so they are checked, saved and
+	// audited with the bundle. A load script still running after its load timed out
+	// has no staged load left
+	if err := stageAlias(taskID, alias); err != nil {
+		logging.LogError(err, "Rejected alias command", "name", command.Name)
+		return err
+	}
+
+	return nil
+}
+
+func registerAliasCommand(alias RegisteredAlias) {
+	command := alias.Command
+
 	command.TaskFunctionCreateTasking = func(taskData *agentstructs.PTTaskMessageAllData) agentstructs.PTTaskCreateTaskingMessageResponse {
 		response := agentstructs.PTTaskCreateTaskingMessageResponse{
 			TaskID: taskData.Task.ID,
 			Success: false,
 		}
 
+		if err := checkTaskPolicy(taskData, policy.ActionInvoke, command.Name); err != nil {
+			response.Error = err.Error()
+			return response
+		}
+
+		if err := checkAliasApproved(command.Name); err != nil {
+			response.Error = err.Error()
+			return response
+		}
+
+		if err := verifyAliasBundle(command.Name); err != nil {
+			logging.LogError(err, "Refused to run alias from modified bundle", "name", command.Name)
+			writeAuditEntry(taskData, mythicrpc.MESSAGE_LEVEL_WARNING, fmt.Sprintf("%s: %s", payloadName, err.Error()))
+			response.Error = err.Error()
+			return response
+		}
+
+		if len(alias.Architectures) > 0 && !slices.ContainsFunc(alias.Architectures, func(arch string) bool {
+			return strings.EqualFold(arch, taskData.Callback.Architecture)
+		}) {
+			response.Error = fmt.Sprintf("alias %s does not support the %s architecture (supported: %s)", command.Name, taskData.Callback.Architecture, strings.Join(alias.Architectures, ", "))
+			return response
+		}
+
 		aliasTask := AliasTask{
 			Callback: taskData.Callback,
 			CommandLine: taskData.Args.GetRawCommandLine(),
@@ -178,7 +263,13 @@ func AddAliasCommand(scriptPath string, callbackID int, taskID int, command agen
 			return response
 		}
 
-		aliasCallbackResult, err := python.RunAliasCallback(scriptPath, taskData.Task.ID, command.Name, string(serializedTask))
+		bundle := aliasBundle(command.Name)
+		if bundle == nil {
+			response.Error = fmt.Sprintf("alias %s is no longer registered", command.Name)
+			return response
+		}
+
+		aliasCallbackResult, err := runCachedAliasCallback(bundle, alias, taskData.Task.ID, string(serializedTask))
 		if err != nil {
 			logging.LogError(err, "Could not run alias callback")
 			response.Error = err.Error()
@@ -260,6 +351,8 @@ func AddAliasCommand(scriptPath string, callbackID int, taskID int, command agen
 		}
 
 		taskData.Args = newTaskArgs
+		auditAliasInvocation(taskData, command.Name, bundle, aliasCommand)
+
 		response.Success = true
 		return response
 	}
@@ -279,5 +372,4 @@ func AddAliasCommand(scriptPath string, callbackID int, taskID int, command agen
 	command.CommandAttributes.CommandIsSuggested = true
 	agentstructs.AllPayloadData.Get(payloadName).AddCommand(command)
 	logging.LogDebug("Registered alias", "name", command.Name)
-	return nil
 }
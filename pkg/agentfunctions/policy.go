@@ -0,0 +1,44 @@
+package agentfunctions
+
+import (
+	"fmt"
+
+	"github.com/MythicAgents/forgescript/pkg/config"
+	"github.com/MythicAgents/forgescript/pkg/policy"
+	agentstructs "github.com/MythicMeta/MythicContainer/agent_structs"
+)
+
+// Checks whether the operator and operation of the task are allowed to perform the
+// action. The policy file is read on every check so changes apply without restarting
+// the container. Returns an error naming the policy which denied the task
+func checkTaskPolicy(taskData *agentstructs.PTTaskMessageAllData, action string, aliasName string) error {
+	return checkPolicy(policy.Request{
+		Operator:  taskData.Task.OperatorUsername,
+		Operation: taskData.Callback.OperationName,
+		Action:    action,
+		Alias:     aliasName,
+	})
+}
+
+// Checks whether bundles from the container filesystem are allowed to perform the
+// action. They are checked as the local operator without an operation
+func checkLocalPolicy(action string) error {
+	return checkPolicy(policy.Request{
+		Operator: localOperator,
+		Action:   action,
+	})
+}
+
+func checkPolicy(request policy.Request) error {
+	policyPath := config.GetPolicyPath()
+	if len(policyPath) == 0 {
+		return nil
+	}
+
+	policies, err := policy.Load(policyPath)
+	if err != nil {
+		return fmt.Errorf("could not load policies %w", err)
+	}
+
+	return policies.Check(request)
+}
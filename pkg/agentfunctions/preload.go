@@ -0,0 +1,53 @@
+package agentfunctions
+
+import (
+	"os"
+	"path"
+	"strings"
+
+	"github.com/MythicAgents/forgescript/pkg/config"
+	"github.com/MythicMeta/MythicContainer/logging"
+)
+
+// Prefix of the file IDs given to preloaded bundles
+const preloadFileIDPrefix = "preload:"
+
+// Number of aliases registered by preloaded bundles
+var preloadedAliases = 0
+
+// Loads every bundle archive and unpacked bundle directory in the preload directory.
+// A bundle which fails to load is logged and skipped. Must be called after the Python
+// executor loop is started and before the container connects to Mythic
+func PreloadBundles() {
+	preloadDir := config.GetPreloadPath()
+	if len(preloadDir) == 0 {
+		return
+	}
+
+	entries, err := os.ReadDir(preloadDir)
+	if err != nil {
+		logging.LogError(err, "could not read bundle preload directory", "path", preloadDir)
+		return
+	}
+
+	loaded := 0
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		bundlePath := path.Join(preloadDir, entry.Name())
+
+		bundle, _, err := loadLocalBundle(bundlePath, preloadFileIDPrefix, "")
+		if err != nil {
+			logging.LogError(err, "could not preload bundle", "path", bundlePath)
+			continue
+		}
+
+		logging.LogInfo("Preloaded bundle", "path", bundlePath, "name", bundle.Name, "aliases", len(bundle.Aliases), "pending_approval", bundle.PendingApproval)
+		preloadedAliases += len(bundle.Aliases)
+		loaded += 1
+	}
+
+	logging.LogInfo("Preloaded bundles", "path", preloadDir, "count", loaded, "aliases", preloadedAliases)
+}
@@ -0,0 +1,751 @@
+package agentfunctions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MythicAgents/forgescript/pkg/config"
+	"github.com/MythicAgents/forgescript/pkg/manifest"
+	"github.com/MythicAgents/forgescript/pkg/python"
+	agentstructs "github.com/MythicMeta/MythicContainer/agent_structs"
+	"github.com/MythicMeta/MythicContainer/logging"
+)
+
+type RegisteredAlias struct {
+	ScriptPath string               `json:"script_path"`
+	Command    agentstructs.Command `json:"command"`
+
+	// Callback architectures the alias can be run on. Empty for any
+	Architectures []string `json:"architectures,omitempty"`
+
+	// Name passed to register_alias if the alias was registered under a different name
+	ScriptName string `json:"script_name,omitempty"`
+
+	// SHA-256 digest of the bundle archive the script is run from. Empty if the
+	// script was extracted
+	Archive string `json:"archive,omitempty"`
+}
+
+// Returns the name the load script used when registering the alias
+func (alias RegisteredAlias) CallbackName() string {
+	if len(alias.ScriptName) > 0 {
+		return alias.ScriptName
+	}
+
+	return alias.Command.Name
+}
+
+type RegisteredBundle struct {
+	Name        string             `json:"name"`
+	FileID      string             `json:"file_id"`
+	FileName    string             `json:"file_name"`
+	SHA256      string             `json:"sha256,omitempty"`
+	Signer      string             `json:"signer,omitempty"`
+	ExtractPath string             `json:"extract_path"`
+	Script      string             `json:"script"`
+	Manifest    *manifest.Manifest `json:"manifest,omitempty"`
+	Operator    string             `json:"operator"`
+	TaskID      int                `json:"task_id"`
+	LoadedAt    time.Time          `json:"loaded_at"`
+	Aliases     []RegisteredAlias  `json:"aliases"`
+
+	// Set when the bundle is run from its zip archive in memory instead of being
+	// extracted
+	Packed bool `json:"packed,omitempty"`
+
+	// Set while the aliases of the bundle are waiting for approval by a second operator
+	PendingApproval bool `json:"pending_approval,omitempty"`
+
+	// Operator who approved the bundle
+	ApprovedBy string `json:"approved_by,omitempty"`
+
+	// SHA-256 hash of every extracted file keyed by path, recorded when the bundle
+	// was loaded and checked before each alias invocation
+	FileHashes map[string]string `json:"file_hashes,omitempty"`
+
+	// Path of the bundle on the container filesystem if it was not uploaded to Mythic.
+	// Local bundles are not saved in the registry since they are loaded again on
+	// every start
+	LocalPath string `json:"-"`
+
+	// Set when the load reused an existing extraction of the bundle
+	reused bool
+
+	// Interpreters which ran the entry scripts while the bundle was being loaded. They
+	// are kept for the aliases of the bundle when the load is committed
+	interpreters []*python.ScriptInterpreter
+}
+
+// Returns the scripts which were run when loading the bundle
+func (bundle *RegisteredBundle) entryScripts() []string {
+	if bundle.Manifest != nil {
+		return bundle.Manifest.EntryScripts
+	}
+
+	return []string{bundle.Script}
+}
+
+// Returns how long the entry scripts of the bundle may run. The manifest can only
+// lower the configured timeout
+func (bundle *RegisteredBundle) loadTimeout() time.Duration {
+	if bundle.Manifest == nil {
+		return config.GetLoadTimeout()
+	}
+
+	return boundedTimeout(time.Duration(bundle.Manifest.LoadTimeout), config.GetLoadTimeout())
+}
+
+// Returns how long an alias callback of the bundle may run. The manifest can only
+// lower the configured timeout
+func (bundle *RegisteredBundle) invokeTimeout() time.Duration {
+	if bundle.Manifest == nil {
+		return config.GetInvokeTimeout()
+	}
+
+	return boundedTimeout(time.Duration(bundle.Manifest.InvokeTimeout), config.GetInvokeTimeout())
+}
+
+// Returns the shorter of the timeouts, where 0 means no timeout
+func boundedTimeout(manifestTimeout time.Duration, configured time.Duration) time.Duration {
+	if manifestTimeout > 0 && (configured == 0 || manifestTimeout < configured) {
+		return manifestTimeout
+	}
+
+	return configured
+}
+
+// Returns true if both bundles were loaded from identical contents
+func (bundle *RegisteredBundle) sameContents(other *RegisteredBundle) bool {
+	return len(bundle.SHA256) > 0 && bundle.SHA256 == other.SHA256
+}
+
+type aliasRegistry struct {
+	Bundles []*RegisteredBundle `json:"bundles"`
+}
+
+var (
+	registryMutex sync.Mutex
+	registry      = aliasRegistry{}
+
+	// Bundles which are currently running their load script keyed by task ID
+	pendingBundles = map[int]*pendingBundle{}
+
+	// Alias names accepted by Mythic
+	aliasNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+)
+
+type pendingBundle struct {
+	bundle *RegisteredBundle
+
+	// File ID of the loaded bundle which this bundle replaces
+	replaces string
+}
+
+// Returns the bundle name for an uploaded bundle file name with the archive
+// extensions removed
+func bundleNameFromFile(fileName string) string {
+	for _, ext := range []string{".tar.gz", ".tgz", ".tar.bz2", ".tar.xz", ".tar.zst", ".tar", ".zip", ".py"} {
+		if trimmed, ok := strings.CutSuffix(fileName, ext); ok {
+			return trimmed
+		}
+	}
+
+	return fileName
+}
+
+// Marks the bundle as being loaded by the specified task.
+// Aliases registered by the task are staged in the bundle until commitBundleLoad
+// or abortBundleLoad is called. If replaceFileID is not empty, the loaded bundle with
+// that file ID is replaced when the load is committed
+func beginBundleLoad(taskID int, bundle *RegisteredBundle, replaceFileID string) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	pendingBundles[taskID] = &pendingBundle{
+		bundle:   bundle,
+		replaces: replaceFileID,
+	}
+}
+
+// Discards the aliases staged by the task
+func abortBundleLoad(taskID int) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	if pending, ok := pendingBundles[taskID]; ok {
+		closeLoadInterpreters(pending.bundle)
+	}
+
+	delete(pendingBundles, taskID)
+}
+
+// Discards the load staged by the task if a loaded bundle has the same contents, load
+// script and aliases.
+// Returns a copy of the loaded bundle or nil if the load still needs to be committed
+func skipIdenticalBundleLoad(taskID int) *RegisteredBundle {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	pending, ok := pendingBundles[taskID]
+	if !ok || len(pending.replaces) > 0 {
+		return nil
+	}
+
+	for _, loaded := range registry.Bundles {
+		if !loaded.sameContents(pending.bundle) || loaded.Script != pending.bundle.Script {
+			continue
+		}
+
+		if len(loaded.Aliases) != len(pending.bundle.Aliases) {
+			continue
+		}
+
+		identical := true
+		for _, alias := range pending.bundle.Aliases {
+			idx := slices.IndexFunc(loaded.Aliases, func(a RegisteredAlias) bool {
+				return a.Command.Name == alias.Command.Name
+			})
+
+			if idx < 0 || loaded.Aliases[idx].ScriptPath != alias.ScriptPath || loaded.Aliases[idx].CallbackName() != alias.CallbackName() || len(diffCommand(loaded.Aliases[idx].Command, alias.Command)) > 0 {
+				identical = false
+				break
+			}
+		}
+
+		if identical {
+			closeLoadInterpreters(pending.bundle)
+			delete(pendingBundles, taskID)
+
+			bundleCopy := *loaded
+			bundleCopy.Aliases = slices.Clone(loaded.Aliases)
+			return &bundleCopy
+		}
+	}
+
+	return nil
+}
+
+// Returned when the aliases of a bundle were registered but the registry could not be
+// written, so the aliases are lost on restart
+var errAliasesNotSaved = errors.New("aliases are registered but could not be saved to the alias registry and will be lost when the container restarts")
+
+// Returned when aliases were removed but the registry could not be written, so the
+// aliases come back on restart
+var errRemovalNotSaved = errors.New("aliases were removed but the alias registry could not be saved and they will be registered again when the container restarts")
+
+// Registers the aliases staged by the task and stores the bundle in the persistent
+// registry. If the load replaces a bundle, any aliases of the replaced bundle which
+// were not registered again are removed.
+// Returns the replaced bundle. A nil bundle with an error means nothing was changed.
+// The error wraps errAliasesNotSaved if the aliases were registered but not saved
+func commitBundleLoad(taskID int) (*RegisteredBundle, error) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	pending, ok := pendingBundles[taskID]
+	if !ok {
+		return nil, fmt.Errorf("no bundle is being loaded by task %d", taskID)
+	}
+
+	delete(pendingBundles, taskID)
+
+	bundle := pending.bundle
+	replaceFileID := pending.replaces
+
+	// The interpreters of the load are only kept if its aliases are registered
+	defer closeLoadInterpreters(bundle)
+
+	var previous *RegisteredBundle
+	if len(replaceFileID) > 0 {
+		idx := slices.IndexFunc(registry.Bundles, func(b *RegisteredBundle) bool {
+			return b.FileID == replaceFileID
+		})
+
+		if idx < 0 {
+			return nil, fmt.Errorf("bundle '%s' is not loaded", replaceFileID)
+		} else if len(bundle.Aliases) == 0 {
+			return nil, errors.New("new bundle did not register any aliases")
+		}
+
+		previous = registry.Bundles[idx]
+		for _, alias := range previous.Aliases {
+			if !slices.ContainsFunc(bundle.Aliases, func(a RegisteredAlias) bool {
+				return a.Command.Name == alias.Command.Name
+			}) {
+				agentstructs.AllPayloadData.Get(payloadName).RemoveCommand(alias.Command)
+			}
+		}
+
+		dropBundle(previous, bundle)
+	}
+
+	if len(bundle.Aliases) == 0 {
+		releaseBundleFiles(bundle)
+		return previous, nil
+	}
+
+	// Aliases registered by this bundle replace the ones previously registered
+	// under the same name so the previous owners no longer hold them
+	for _, alias := range bundle.Aliases {
+		if owner, idx := findAliasOwner(alias.Command.Name); owner != nil {
+			owner.Aliases = slices.Delete(owner.Aliases, idx, idx+1)
+		}
+
+		registerAliasCommand(alias)
+	}
+
+	for _, owner := range slices.Clone(registry.Bundles) {
+		if len(owner.Aliases) == 0 {
+			dropBundle(owner, bundle)
+		}
+	}
+
+	registry.Bundles = append(registry.Bundles, bundle)
+	keepLoadInterpreters(bundle)
+
+	if err := saveRegistry(); err != nil {
+		return previous, fmt.Errorf("%w (%s)", errAliasesNotSaved, err.Error())
+	}
+
+	return previous, nil
+}
+
+// Removes the alias from the payload commands and from the bundle which registered
+// it. The bundle is removed as well if this was its last alias.
+// Returns the bundle which owned the alias
+func unregisterAlias(name string) (*RegisteredBundle, error) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	owner, idx := findAliasOwner(name)
+	if owner == nil {
+		return nil, fmt.Errorf("alias '%s' was not registered by a loaded bundle", name)
+	}
+
+	agentstructs.AllPayloadData.Get(payloadName).RemoveCommand(owner.Aliases[idx].Command)
+	owner.Aliases = slices.Delete(owner.Aliases, idx, idx+1)
+
+	if len(owner.Aliases) == 0 {
+		dropBundle(owner)
+	}
+
+	if err := saveRegistry(); err != nil {
+		return owner, fmt.Errorf("%w (%s)", errRemovalNotSaved, err.Error())
+	}
+
+	return owner, nil
+}
+
+// Removes every alias registered by the bundle with the specified file ID along with
+// the extracted bundle files
+func unregisterBundle(fileID string) (*RegisteredBundle, error) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	idx := slices.IndexFunc(registry.Bundles, func(bundle *RegisteredBundle) bool {
+		return bundle.FileID == fileID
+	})
+
+	if idx < 0 {
+		return nil, fmt.Errorf("bundle '%s' is not loaded", fileID)
+	}
+
+	bundle := registry.Bundles[idx]
+	for _, alias := range bundle.Aliases {
+		agentstructs.AllPayloadData.Get(payloadName).RemoveCommand(alias.Command)
+	}
+
+	dropBundle(bundle)
+	if err := saveRegistry(); err != nil {
+		return bundle, fmt.Errorf("%w (%s)", errRemovalNotSaved, err.Error())
+	}
+
+	return bundle, nil
+}
+
+// Returns the bundle and alias index for the bundle which currently owns the alias.
+// The registry mutex must be held
+func findAliasOwner(name string) (*RegisteredBundle, int) {
+	for _, bundle := range registry.Bundles {
+		idx := slices.IndexFunc(bundle.Aliases, func(alias RegisteredAlias) bool {
+			return alias.Command.Name == name
+		})
+
+		if idx >= 0 {
+			return bundle, idx
+		}
+	}
+
+	return nil, -1
+}
+
+// Removes the bundle from the registry, closes the interpreters holding its alias
+// callbacks and releases its files if no other bundle is using them. The registry
+// mutex must be held
+func dropBundle(bundle *RegisteredBundle, keep ...*RegisteredBundle) {
+	registry.Bundles = slices.DeleteFunc(registry.Bundles, func(b *RegisteredBundle) bool {
+		return b == bundle
+	})
+
+	dropAliasInterpreters(bundle.FileID)
+	releaseBundleFiles(bundle, keep...)
+}
+
+// Deletes the extracted files or the archive in memory of the bundle unless a loaded
+// bundle, a bundle being loaded or one of the kept bundles uses them. The registry
+// mutex must be held
+func releaseBundleFiles(bundle *RegisteredBundle, keep ...*RegisteredBundle) {
+	if bundle.Packed {
+		if !archiveInUse(bundle.SHA256, keep...) {
+			delete(packedArchives, bundle.SHA256)
+		}
+
+		return
+	}
+
+	if extractPathInUse(bundle.ExtractPath, keep...) {
+		return
+	}
+
+	if err := os.RemoveAll(bundle.ExtractPath); err != nil {
+		logging.LogError(err, "could not remove extracted bundle", "path", bundle.ExtractPath)
+	}
+}
+
+// Returns the loaded bundles, the bundles being loaded and the kept bundles.
+// The registry mutex must be held
+func bundlesInUse(keep ...*RegisteredBundle) []*RegisteredBundle {
+	for _, pending := range pendingBundles {
+		keep = append(keep, pending.bundle)
+	}
+
+	return slices.Concat(registry.Bundles, keep)
+}
+
+// Returns true if a bundle in use was extracted to the path. The registry mutex must
+// be held
+func extractPathInUse(extractPath string, keep ...*RegisteredBundle) bool {
+	return slices.ContainsFunc(bundlesInUse(keep...), func(bundle *RegisteredBundle) bool {
+		return !bundle.Packed && bundle.ExtractPath == extractPath
+	})
+}
+
+// Returns true if a bundle in use is run from the archive with the digest. The
+// registry mutex must be held
+func archiveInUse(digest string, keep ...*RegisteredBundle) bool {
+	return slices.ContainsFunc(bundlesInUse(keep...), func(bundle *RegisteredBundle) bool {
+		return bundle.Packed && bundle.SHA256 == digest
+	})
+}
+
+// Removes the files of a bundle which failed to load unless another bundle uses the
+// same files
+func discardBundleFiles(bundle *RegisteredBundle) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	releaseBundleFiles(bundle)
+}
+
+// Returns a copy of the bundle which registered the alias or nil if the alias is not
+// registered
+func aliasBundle(name string) *RegisteredBundle {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	owner, _ := findAliasOwner(name)
+	if owner == nil {
+		return nil
+	}
+
+	bundleCopy := *owner
+	bundleCopy.Aliases = slices.Clone(owner.Aliases)
+	return &bundleCopy
+}
+
+// Returns an error if the alias was registered by a bundle which is waiting for approval
+func checkAliasApproved(name string) error {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	if owner, _ := findAliasOwner(name); owner != nil && owner.PendingApproval {
+		return fmt.Errorf("alias '%s' cannot be used until bundle '%s' (%s) loaded by %s is approved by another operator with %s_approve", name, owner.Name, owner.FileID, owner.Operator, payloadName)
+	}
+
+	return nil
+}
+
+// Activates the aliases of a bundle which is waiting for approval. The approving
+// operator must not be the operator who loaded the bundle.
+// Returns a copy of the approved bundle
+func approveBundle(fileID string, operator string) (*RegisteredBundle, error) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	idx := slices.IndexFunc(registry.Bundles, func(bundle *RegisteredBundle) bool {
+		return bundle.FileID == fileID
+	})
+
+	if idx < 0 {
+		return nil, fmt.Errorf("bundle '%s' is not loaded", fileID)
+	}
+
+	bundle := registry.Bundles[idx]
+	if !bundle.PendingApproval {
+		return nil, fmt.Errorf("bundle '%s' is not waiting for approval", fileID)
+	} else if bundle.Operator == operator {
+		return nil, fmt.Errorf("bundle '%s' was loaded by %s and must be approved by a different operator", fileID, operator)
+	}
+
+	bundle.PendingApproval = false
+	bundle.ApprovedBy = operator
+
+	bundleCopy := *bundle
+	bundleCopy.Aliases = slices.Clone(bundle.Aliases)
+	if err := saveRegistry(); err != nil {
+		return &bundleCopy, fmt.Errorf("bundle was approved but the approval could not be saved to the alias registry and will be lost when the container restarts (%s)", err.Error())
+	}
+
+	return &bundleCopy, nil
+}
+
+// Returns a copy of every bundle in the registry
+func loadedBundles() []RegisteredBundle {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	bundles := make([]RegisteredBundle, 0, len(registry.Bundles))
+	for _, bundle := range registry.Bundles {
+		bundleCopy := *bundle
+		bundleCopy.Aliases = slices.Clone(bundle.Aliases)
+		bundles = append(bundles, bundleCopy)
+	}
+
+	return bundles
+}
+
+// Stages the alias in the bundle being loaded by the task after checking that the
+// alias name is valid and not in use according to the configured conflict policy.
+// Fails if the task is not loading a bundle
+func stageAlias(taskID int, alias RegisteredAlias) error {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	pending, ok := pendingBundles[taskID]
+	if !ok {
+		return fmt.Errorf("task %d is not loading a bundle", taskID)
+	}
+
+	bundle := pending.bundle
+	name := alias.Command.Name
+
+	if !aliasNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid alias name '%s'. Names must start with a letter or digit and only contain letters, digits, '_', '-' or '.'", name)
+	}
+
+	conflict := ""
+	if isBuiltinCommand(name) {
+		conflict = fmt.Sprintf("alias name '%s' is a builtin forgescript command", name)
+	} else if owner, _ := findAliasOwner(name); owner != nil && owner.FileID != pending.replaces && !owner.sameContents(bundle) {
+		// Aliases of the bundle being replaced or of an identical bundle can always be
+		// registered again
+		if config.GetAliasConflictPolicy() == config.AliasConflictReject || !sameBundle(owner, bundle) {
+			conflict = fmt.Sprintf("alias '%s' is already registered by bundle '%s' (%s)", name, owner.Name, owner.FileID)
+		}
+	}
+
+	if len(conflict) > 0 {
+		if config.GetAliasConflictPolicy() != config.AliasConflictPrefix {
+			return errors.New(conflict)
+		}
+
+		prefixed := fmt.Sprintf("%s_%s", bundle.Name, name)
+		if owner, _ := findAliasOwner(prefixed); !aliasNamePattern.MatchString(prefixed) || isBuiltinCommand(prefixed) || (owner != nil && !sameBundle(owner, bundle) && owner.FileID != pending.replaces) {
+			return fmt.Errorf("%s and the prefixed name '%s' cannot be used", conflict, prefixed)
+		}
+
+		logging.LogInfo("Prefixed conflicting alias name", "name", name, "prefixed", prefixed)
+		alias.ScriptName = name
+		alias.Command.Name = prefixed
+	}
+
+	if bundle.Manifest != nil {
+		if len(alias.Command.CommandAttributes.SupportedOS) == 0 {
+			alias.Command.CommandAttributes.SupportedOS = slices.Clone(bundle.Manifest.SupportedOS)
+		}
+
+		alias.Architectures = slices.Clone(bundle.Manifest.Architectures)
+	}
+
+	if bundle.Packed {
+		alias.Archive = bundle.SHA256
+	}
+
+	for i := range bundle.Aliases {
+		if bundle.Aliases[i].Command.Name == alias.Command.Name {
+			bundle.Aliases[i] = alias
+			return nil
+		}
+	}
+
+	bundle.Aliases = append(bundle.Aliases, alias)
+	return nil
+}
+
+// Returns true if both bundles have the same name and owner. Names come from the
+// uploaded file or the manifest and can be chosen by anyone who can upload a bundle, so
+// signed bundles must be signed by the same trusted key and unsigned bundles must be
+// loaded by the same operator
+func sameBundle(owner *RegisteredBundle, bundle *RegisteredBundle) bool {
+	if len(owner.Name) == 0 || owner.Name != bundle.Name {
+		return false
+	} else if len(owner.Signer) > 0 || len(bundle.Signer) > 0 {
+		return owner.Signer == bundle.Signer
+	}
+
+	return owner.Operator == bundle.Operator
+}
+
+// Writes the registry to the cache directory. The registry mutex must be held
+func saveRegistry() error {
+	registryPath := config.GetForgeScriptRegistryPath()
+	if err := os.MkdirAll(path.Dir(registryPath), 0700); err != nil {
+		return err
+	}
+
+	saved := aliasRegistry{
+		Bundles: slices.DeleteFunc(slices.Clone(registry.Bundles), func(bundle *RegisteredBundle) bool {
+			return len(bundle.LocalPath) > 0
+		}),
+	}
+
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so that a crash does not leave a truncated registry
+	tmpPath := registryPath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, registryPath)
+}
+
+// Reads the registry saved in the cache directory. Returns an empty registry if none
+// was saved
+func readSavedRegistry() (aliasRegistry, error) {
+	saved := aliasRegistry{}
+
+	data, err := os.ReadFile(config.GetForgeScriptRegistryPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return saved, nil
+	} else if err != nil {
+		return saved, err
+	}
+
+	err = json.Unmarshal(data, &saved)
+	return saved, err
+}
+
+// Reads the registry from the cache directory and re-registers each alias.
+// Returns the number of aliases restored
+func restoreRegistry() (int, error) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	saved, err := readSavedRegistry()
+	if err != nil {
+		return 0, err
+	}
+
+	restored := 0
+	updated := false
+	dropped := []*RegisteredBundle{}
+	registry.Bundles = []*RegisteredBundle{}
+	for _, bundle := range saved.Bundles {
+		// Archives of packed bundles are fetched from Mythic and checked when one of
+		// their aliases is first run
+		if !bundle.Packed && !checkRestoredBundle(bundle) {
+			dropped = append(dropped, bundle)
+			continue
+		}
+
+		// Registries saved before file hashes were recorded. Only the files of signed
+		// bundles were just checked against their signed manifest, so unsigned bundles
+		// must be loaded again
+		if !bundle.Packed && bundle.FileHashes == nil {
+			if len(bundle.Signer) == 0 {
+				logging.LogError(errors.New("no file hashes were recorded for the bundle"), "dropping unsigned bundle whose integrity cannot be established from registry. Load it again to restore its aliases", "file_id", bundle.FileID, "name", bundle.Name)
+				dropped = append(dropped, bundle)
+				continue
+			}
+
+			hashes, err := hashExtractedBundle(bundle.ExtractPath)
+			if err != nil {
+				logging.LogError(err, "dropping bundle whose files could not be hashed from registry", "file_id", bundle.FileID)
+				dropped = append(dropped, bundle)
+				continue
+			}
+
+			logging.LogInfo("Recorded file hashes for restored bundle", "file_id", bundle.FileID, "files", len(hashes))
+			bundle.FileHashes = hashes
+			updated = true
+		}
+
+		for _, alias := range bundle.Aliases {
+			registerAliasCommand(alias)
+			restored += 1
+		}
+
+		registry.Bundles = append(registry.Bundles, bundle)
+	}
+
+	// The files of dropped bundles cannot be trusted and must not be reused when the
+	// same bundle is loaded again
+	for _, bundle := range dropped {
+		releaseBundleFiles(bundle)
+	}
+
+	if updated || len(registry.Bundles) != len(saved.Bundles) {
+		if err := saveRegistry(); err != nil {
+			return restored, err
+		}
+	}
+
+	return restored, nil
+}
+
+// Checks that the extracted files of a bundle from the saved registry are still
+// present and signed by a trusted key.
+// Returns false if the bundle should be dropped
+func checkRestoredBundle(bundle *RegisteredBundle) bool {
+	for _, script := range bundle.entryScripts() {
+		if _, err := os.Stat(path.Join(bundle.ExtractPath, script)); err != nil {
+			logging.LogError(err, "dropping bundle with missing load script from registry", "file_id", bundle.FileID, "script", script)
+			return false
+		}
+	}
+
+	// Signed bundles are checked again in case the trusted keys changed
+	if len(bundle.Signer) > 0 || config.GetRequireSignedBundles() {
+		signer, err := verifyExtractedBundle(bundle.ExtractPath)
+		if err != nil {
+			logging.LogError(err, "dropping bundle which failed signature verification from registry", "file_id", bundle.FileID)
+			return false
+		}
+
+		bundle.Signer = signer
+	}
+
+	return true
+}
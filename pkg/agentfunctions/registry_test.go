@@ -0,0 +1,102 @@
+package agentfunctions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/MythicAgents/forgescript/pkg/config"
+	"github.com/MythicAgents/forgescript/pkg/manifest"
+	agentstructs "github.com/MythicMeta/MythicContainer/agent_structs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBundleTimeouts(t *testing.T) {
+	defer config.SetLoadTimeout(config.GetLoadTimeout())
+	defer config.SetInvokeTimeout(config.GetInvokeTimeout())
+
+	config.SetLoadTimeout(time.Minute)
+	config.SetInvokeTimeout(30 * time.Second)
+
+	bundle := &RegisteredBundle{}
+	assert.Equal(t, time.Minute, bundle.loadTimeout(), "bundle without a manifest should use the configured load timeout")
+	assert.Equal(t, 30*time.Second, bundle.invokeTimeout(), "bundle without a manifest should use the configured invoke timeout")
+
+	bundle.Manifest = &manifest.Manifest{
+		LoadTimeout:   manifest.Duration(10 * time.Second),
+		InvokeTimeout: manifest.Duration(5 * time.Second),
+	}
+	assert.Equal(t, 10*time.Second, bundle.loadTimeout(), "manifest should be able to lower the load timeout")
+	assert.Equal(t, 5*time.Second, bundle.invokeTimeout(), "manifest should be able to lower the invoke timeout")
+
+	bundle.Manifest = &manifest.Manifest{
+		LoadTimeout:   manifest.Duration(1000 * time.Hour),
+		InvokeTimeout: manifest.Duration(1000 * time.Hour),
+	}
+	assert.Equal(t, time.Minute, bundle.loadTimeout(), "manifest should not be able to raise the load timeout")
+	assert.Equal(t, 30*time.Second, bundle.invokeTimeout(), "manifest should not be able to raise the invoke timeout")
+
+	config.SetLoadTimeout(0)
+	config.SetInvokeTimeout(0)
+	assert.Equal(t, 1000*time.Hour, bundle.loadTimeout(), "manifest load timeout should apply when the configured one is disabled")
+	assert.Equal(t, 1000*time.Hour, bundle.invokeTimeout(), "manifest invoke timeout should apply when the configured one is disabled")
+
+	bundle.Manifest = &manifest.Manifest{}
+	assert.Equal(t, time.Duration(0), bundle.loadTimeout(), "load timeout should stay disabled")
+	assert.Equal(t, time.Duration(0), bundle.invokeTimeout(), "invoke timeout should stay disabled")
+}
+
+func TestStageAliasReplace(t *testing.T) {
+	defer config.SetAliasConflictPolicy(string(config.GetAliasConflictPolicy()))
+	assert.Nil(t, config.SetAliasConflictPolicy(string(config.AliasConflictReplace)))
+
+	registryMutex.Lock()
+	savedBundles := registry.Bundles
+	registryMutex.Unlock()
+	defer func() {
+		registryMutex.Lock()
+		registry.Bundles = savedBundles
+		registryMutex.Unlock()
+	}()
+
+	alias := RegisteredAlias{Command: agentstructs.Command{Name: "whoami"}}
+
+	tests := []struct {
+		name    string
+		owner   RegisteredBundle
+		bundle  RegisteredBundle
+		replace bool
+	}{
+		{"unsigned same operator", RegisteredBundle{Name: "sa", Operator: "alice"}, RegisteredBundle{Name: "sa", Operator: "alice"}, true},
+		{"unsigned other operator", RegisteredBundle{Name: "sa", Operator: "alice"}, RegisteredBundle{Name: "sa", Operator: "mallory"}, false},
+		{"unsigned other name", RegisteredBundle{Name: "sa", Operator: "alice"}, RegisteredBundle{Name: "other", Operator: "alice"}, false},
+		{"signed same key", RegisteredBundle{Name: "sa", Operator: "alice", Signer: "lead"}, RegisteredBundle{Name: "sa", Operator: "bob", Signer: "lead"}, true},
+		{"signed other key", RegisteredBundle{Name: "sa", Operator: "alice", Signer: "lead"}, RegisteredBundle{Name: "sa", Operator: "alice", Signer: "other"}, false},
+		{"unsigned over signed", RegisteredBundle{Name: "sa", Operator: "alice", Signer: "lead"}, RegisteredBundle{Name: "sa", Operator: "alice"}, false},
+	}
+
+	for i, test := range tests {
+		owner := test.owner
+		owner.FileID = "owner"
+		owner.SHA256 = "owner-digest"
+		owner.Aliases = []RegisteredAlias{alias}
+
+		bundle := test.bundle
+		bundle.FileID = "new"
+		bundle.SHA256 = "new-digest"
+
+		registryMutex.Lock()
+		registry.Bundles = []*RegisteredBundle{&owner}
+		registryMutex.Unlock()
+
+		taskID := -300 - i
+		beginBundleLoad(taskID, &bundle, "")
+		err := stageAlias(taskID, alias)
+		abortBundleLoad(taskID)
+
+		if test.replace {
+			assert.Nil(t, err, "%s: alias should be replaced", test.name)
+		} else {
+			assert.NotNil(t, err, "%s: alias should conflict", test.name)
+		}
+	}
+}
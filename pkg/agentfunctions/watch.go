@@ -0,0 +1,147 @@
+package agentfunctions
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/MythicAgents/forgescript/pkg/config"
+	"github.com/MythicAgents/forgescript/pkg/policy"
+	"github.com/MythicMeta/MythicContainer/logging"
+	"github.com/MythicMeta/MythicContainer/rabbitmq"
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	// Prefix of the file IDs given to watched bundles
+	watchFileIDPrefix = "watch:"
+
+	// Time to wait after the last change before reloading so that saving several files
+	// at once only reloads the bundle once
+	watchReloadDelay = 500 * time.Millisecond
+)
+
+// Loads the bundle directory configured for watch mode and reloads it whenever a file
+// in the directory changes. Must be called after the Python executor loop is started
+func WatchBundle() {
+	watchDir := config.GetWatchPath()
+	if len(watchDir) == 0 {
+		return
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logging.LogError(err, "could not start bundle watcher", "path", watchDir)
+		return
+	}
+
+	if err := watchBundleDirs(watcher, watchDir); err != nil {
+		logging.LogError(err, "could not watch bundle directory", "path", watchDir)
+		watcher.Close()
+		return
+	}
+
+	reloadWatchedBundle(watchDir)
+
+	logging.LogInfo("Watching bundle directory for changes", "path", watchDir)
+	go runBundleWatcher(watcher, watchDir)
+}
+
+// Adds the directory and each of its subdirectories to the watcher since directories
+// are not watched recursively
+func watchBundleDirs(watcher *fsnotify.Watcher, dir string) error {
+	return filepath.WalkDir(dir, func(dirPath string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.IsDir() {
+			return err
+		}
+
+		return watcher.Add(dirPath)
+	})
+}
+
+func runBundleWatcher(watcher *fsnotify.Watcher, watchDir string) {
+	defer watcher.Close()
+
+	reloadTimer := time.NewTimer(watchReloadDelay)
+	reloadTimer.Stop()
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err := watchBundleDirs(watcher, event.Name); err != nil {
+						logging.LogError(err, "could not watch new bundle directory", "path", event.Name)
+					}
+				}
+			}
+
+			logging.LogDebug("Bundle file changed", "path", event.Name, "op", event.Op.String())
+			reloadTimer.Reset(watchReloadDelay)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+
+			logging.LogError(err, "bundle watcher error", "path", watchDir)
+		case <-reloadTimer.C:
+			if reloadWatchedBundle(watchDir) {
+				rabbitmq.SyncPayloadData(&payloadDefinition.Name, false)
+			}
+		}
+	}
+}
+
+// Loads the watched bundle again, replacing the aliases from the previous load.
+// Returns true if the aliases were updated
+func reloadWatchedBundle(watchDir string) bool {
+	fileID := watchFileIDPrefix + filepath.Base(watchDir)
+
+	replaceFileID := ""
+	if slices.ContainsFunc(loadedBundles(), func(bundle RegisteredBundle) bool {
+		return bundle.FileID == fileID
+	}) {
+		replaceFileID = fileID
+	}
+
+	// The load policy is checked again on every reload so a policy change stops the
+	// next reload. The previous aliases stay registered when a reload is denied
+	bundle, previous, err := loadLocalBundle(watchDir, watchFileIDPrefix, replaceFileID)
+	if err != nil {
+		scriptErr := bundleScriptError{}
+		deniedErr := &policy.DeniedError{}
+		if errors.As(err, &deniedErr) {
+			logging.LogError(err, "watched bundle reload was denied by policy", "path", watchDir)
+		} else if errors.As(err, &scriptErr) {
+			logging.LogError(scriptErr.err, "watched bundle script failed", "path", watchDir, "script", scriptErr.script)
+		} else {
+			logging.LogError(err, "could not load watched bundle", "path", watchDir)
+		}
+
+		return false
+	}
+
+	changes := ""
+	if previous != nil {
+		changes = formatAliasDiff(previous.Aliases, bundle.Aliases)
+	}
+
+	aliasNames := make([]string, 0, len(bundle.Aliases))
+	for _, alias := range bundle.Aliases {
+		aliasNames = append(aliasNames, alias.Command.Name)
+	}
+
+	logging.LogInfo("Loaded watched bundle", "path", watchDir, "sha256", bundle.SHA256, "aliases", aliasNames, "changes", changes, "pending_approval", bundle.PendingApproval)
+	return true
+}
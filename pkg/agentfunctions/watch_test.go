@@ -0,0 +1,33 @@
+package agentfunctions
+
+import (
+	"errors"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/MythicAgents/forgescript/pkg/config"
+	"github.com/MythicAgents/forgescript/pkg/policy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReloadWatchedBundleDenied(t *testing.T) {
+	config.SetForgeScriptRuntimePath(t.TempDir())
+
+	watchDir := t.TempDir()
+	assert.Nil(t, os.WriteFile(path.Join(watchDir, defaultLoadScript), []byte(testBundleScript), 0600), "failed writing watched bundle script")
+
+	policyPath := path.Join(t.TempDir(), "policy.toml")
+	assert.Nil(t, os.WriteFile(policyPath, []byte("default = \"deny\"\n"), 0600), "failed writing policy file")
+
+	config.SetPolicyPath(policyPath)
+	defer config.SetPolicyPath("")
+
+	_, _, err := loadLocalBundle(watchDir, watchFileIDPrefix, "")
+	deniedErr := &policy.DeniedError{}
+	assert.True(t, errors.As(err, &deniedErr), "watched bundle was loaded without a policy allowing it")
+	assert.Equal(t, localOperator, deniedErr.Request.Operator)
+	assert.Equal(t, policy.ActionLoad, deniedErr.Request.Action)
+
+	assert.False(t, reloadWatchedBundle(watchDir), "denied watched bundle reload updated the aliases")
+}
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Policy for handling an alias name which is already in use
+type AliasConflictPolicy string
+
+const (
+	// Reject aliases with names that are already in use
+	AliasConflictReject AliasConflictPolicy = "reject"
+
+	// Replace an existing alias only if it was registered by a bundle with the same name
+	// signed by the same key, or loaded by the same operator if both are unsigned
+	AliasConflictReplace AliasConflictPolicy = "replace"
+
+	// Prefix the alias name with the bundle name if the name is already in use
+	AliasConflictPrefix AliasConflictPolicy = "prefix"
+)
+
+var aliasConflictPolicies = []AliasConflictPolicy{
+	AliasConflictReject,
+	AliasConflictReplace,
+	AliasConflictPrefix,
+}
+
+var aliasConflictPolicy = AliasConflictReplace
+
+func SetAliasConflictPolicy(val string) error {
+	policy := AliasConflictPolicy(val)
+	if !slices.Contains(aliasConflictPolicies, policy) {
+		return fmt.Errorf("unknown alias conflict policy '%s' (expected one of %v)", val, aliasConflictPolicies)
+	}
+
+	aliasConflictPolicy = policy
+	return nil
+}
+
+func GetAliasConflictPolicy() AliasConflictPolicy {
+	return aliasConflictPolicy
+}
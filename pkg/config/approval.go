@@ -0,0 +1,13 @@
+package config
+
+var requireApproval = false
+
+// Sets whether aliases from newly loaded bundles stay inactive until a second operator
+// approves the bundle
+func SetRequireApproval(val bool) {
+	requireApproval = val
+}
+
+func GetRequireApproval() bool {
+	return requireApproval
+}
@@ -0,0 +1,13 @@
+package config
+
+var runFromArchive = false
+
+// Sets whether zip bundles are run from the archive in memory instead of being
+// extracted to the runtime directory
+func SetRunFromArchive(val bool) {
+	runFromArchive = val
+}
+
+func GetRunFromArchive() bool {
+	return runFromArchive
+}
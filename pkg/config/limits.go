@@ -0,0 +1,36 @@
+package config
+
+// Limits applied when decompressing and extracting bundles.
+// A limit of 0 disables the check
+type BundleLimits struct {
+	// Maximum size of the uploaded bundle
+	CompressedSize int64
+
+	// Maximum size of each decompressed layer and of all extracted files combined
+	DecompressedSize int64
+
+	// Maximum number of entries in the bundle archive
+	Entries int
+
+	// Maximum number of path components for an entry in the bundle archive
+	PathDepth int
+
+	// Maximum size of a single extracted file
+	FileSize int64
+}
+
+var bundleLimits = BundleLimits{
+	CompressedSize:   64 << 20,
+	DecompressedSize: 256 << 20,
+	Entries:          4096,
+	PathDepth:        16,
+	FileSize:         64 << 20,
+}
+
+func SetBundleLimits(limits BundleLimits) {
+	bundleLimits = limits
+}
+
+func GetBundleLimits() BundleLimits {
+	return bundleLimits
+}
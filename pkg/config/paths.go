@@ -71,3 +71,7 @@ func GetAndCreateForgeScriptCachePath() string {
 	createNeededDir(cachePath)
 	return cachePath
 }
+
+func GetForgeScriptRegistryPath() string {
+	return path.Join(GetForgeScriptCachePath(), "registry.json")
+}
@@ -0,0 +1,13 @@
+package config
+
+var policyPath = ""
+
+// Sets the path of the file containing the policies for loading, unloading and invoking
+// aliases
+func SetPolicyPath(val string) {
+	policyPath = val
+}
+
+func GetPolicyPath() string {
+	return policyPath
+}
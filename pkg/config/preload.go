@@ -0,0 +1,12 @@
+package config
+
+var preloadPath = ""
+
+// Sets the directory of bundles which are loaded when the container starts
+func SetPreloadPath(val string) {
+	preloadPath = val
+}
+
+func GetPreloadPath() string {
+	return preloadPath
+}
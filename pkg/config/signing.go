@@ -0,0 +1,22 @@
+package config
+
+var trustedKeysPath = ""
+var requireSignedBundles = false
+
+// Sets the path of the file containing the public keys trusted to sign bundles
+func SetTrustedKeysPath(val string) {
+	trustedKeysPath = val
+}
+
+func GetTrustedKeysPath() string {
+	return trustedKeysPath
+}
+
+// Sets whether bundles without a valid signature are refused
+func SetRequireSignedBundles(val bool) {
+	requireSignedBundles = val
+}
+
+func GetRequireSignedBundles() bool {
+	return requireSignedBundles
+}
@@ -0,0 +1,26 @@
+package config
+
+import "time"
+
+var loadTimeout = time.Minute
+var invokeTimeout = 30 * time.Second
+
+// Sets how long the scripts of a bundle may run when it is loaded. 0 disables the
+// timeout
+func SetLoadTimeout(val time.Duration) {
+	loadTimeout = val
+}
+
+func GetLoadTimeout() time.Duration {
+	return loadTimeout
+}
+
+// Sets how long an alias callback may run when the alias is invoked. 0 disables the
+// timeout
+func SetInvokeTimeout(val time.Duration) {
+	invokeTimeout = val
+}
+
+func GetInvokeTimeout() time.Duration {
+	return invokeTimeout
+}
@@ -0,0 +1,12 @@
+package config
+
+var watchPath = ""
+
+// Sets the unpacked bundle directory which is reloaded whenever one of its files changes
+func SetWatchPath(val string) {
+	watchPath = val
+}
+
+func GetWatchPath() string {
+	return watchPath
+}
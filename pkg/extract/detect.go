@@ -0,0 +1,118 @@
+package extract
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"unicode/utf8"
+)
+
+const (
+	mimeTypePython  = "text/x-python"
+	mimeTypeText    = "text/plain"
+	mimeTypeUnknown = "application/octet-stream"
+)
+
+// Number of bytes inspected when detecting the bundle format
+const detectSize = 512
+
+type magicSignature struct {
+	offset   int
+	magic    []byte
+	mimeType string
+}
+
+var magicSignatures = []magicSignature{
+	{offset: 0, magic: []byte{0x1f, 0x8b}, mimeType: mimeTypeGzip},
+	{offset: 0, magic: []byte("BZh"), mimeType: mimeTypeBzip2},
+	{offset: 0, magic: []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, mimeType: mimeTypeXz},
+	{offset: 0, magic: []byte{0x28, 0xb5, 0x2f, 0xfd}, mimeType: mimeTypeZstd},
+	{offset: 0, magic: []byte("PK\x03\x04"), mimeType: mimeTypeZip},
+	{offset: 0, magic: []byte("PK\x05\x06"), mimeType: mimeTypeZip},
+	// POSIX ustar and GNU tar
+	{offset: 257, magic: []byte("ustar\x0000"), mimeType: mimeTypeTar},
+	{offset: 257, magic: []byte("ustar  \x00"), mimeType: mimeTypeTar},
+}
+
+// Statements which commonly start a Python script
+var pythonPrefixes = [][]byte{
+	[]byte("#!/usr/bin/env python"),
+	[]byte("#!/usr/bin/python"),
+	[]byte("import "),
+	[]byte("from "),
+	[]byte("def "),
+	[]byte("class "),
+	[]byte("\"\"\""),
+	[]byte("'''"),
+}
+
+func looksLikePython(data []byte) bool {
+	for line := range bytes.Lines(data) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		for _, prefix := range pythonPrefixes {
+			if bytes.HasPrefix(line, prefix) {
+				return true
+			}
+		}
+
+		// Skip over leading comments
+		if !bytes.HasPrefix(line, []byte("#")) {
+			return false
+		}
+	}
+
+	return false
+}
+
+func isText(sample []byte, truncated bool) bool {
+	if bytes.IndexByte(sample, 0) >= 0 {
+		return false
+	}
+
+	// A truncated sample may end in the middle of a multibyte character
+	for i := 0; truncated && i < utf8.UTFMax-1 && len(sample) > 0 && !utf8.Valid(sample); i++ {
+		sample = sample[:len(sample)-1]
+	}
+
+	return utf8.Valid(sample)
+}
+
+// Detects the format of the bundle from the leading bytes
+func detectMimeType(data []byte) (string, error) {
+	if len(data) == 0 {
+		return "", errors.New("bundle is empty")
+	}
+
+	sample := data[:min(len(data), detectSize)]
+	for _, signature := range magicSignatures {
+		end := signature.offset + len(signature.magic)
+		if len(sample) >= end && bytes.Equal(sample[signature.offset:end], signature.magic) {
+			return signature.mimeType, nil
+		}
+	}
+
+	if isText(sample, len(data) > len(sample)) {
+		if looksLikePython(sample) {
+			return mimeTypePython, nil
+		}
+
+		return mimeTypeText, nil
+	}
+
+	return mimeTypeUnknown, nil
+}
+
+// Detects the format of a stream without consuming any of it
+func detectStreamMimeType(rd *bufio.Reader) (string, error) {
+	sample, err := rd.Peek(detectSize + 1)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+
+	return detectMimeType(sample)
+}
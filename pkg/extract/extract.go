@@ -1,13 +1,20 @@
 package extract
 
 import (
-	"bytes"
+	"bufio"
 	"compress/bzip2"
 	"compress/gzip"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path"
+	"strings"
+
+	"github.com/MythicAgents/forgescript/pkg/config"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
 )
 
 
@@ -17,68 +24,284 @@ const (
 	mimeTypeBzip2 = "application/x-bzip2"
 	mimeTypeGzip = "application/gzip"
 	mimeTypeZip = "application/zip"
+	mimeTypeZstd = "application/zstd"
 )
 
 
+// Maximum number of nested compression layers around a bundle archive
+const maxCompressionLayers = 4
+
+// Returned when a bundle exceeds one of the configured bundle limits
+var ErrLimitExceeded = errors.New("bundle limit exceeded")
+
+// Extracts a bundle into a root directory in a single pass over the bundle and
+// returns the paths of the extracted files. A bundle can only be extracted once
 type BundleExtractor interface {
-	ExtractTo(*os.Root) error
-	ListFilePaths() ([]string, error)
+	ExtractTo(*os.Root) ([]string, error)
 }
 
-func decompressXz(data []byte) ([]byte, error) {
-	return []byte{}, errors.New("xz decompression not implemented")
+// Implemented by bundles which can be read in place instead of being extracted
+type ArchiveBundle interface {
+	BundleExtractor
+	Open() (fs.FS, error)
 }
 
-func decompressBzip2(data []byte) ([]byte, error) {
-	return io.ReadAll(bzip2.NewReader(bytes.NewReader(data)))
+// Returns the cleaned relative path for an archive entry.
+// Absolute paths and paths leaving the extraction root are rejected
+func cleanEntryPath(name string) (string, error) {
+	cleaned := path.Clean(name)
+	if path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("archive entry %s is outside of the bundle", name)
+	}
+
+	return cleaned, nil
 }
 
-func decompressGzip(data []byte) ([]byte, error) {
-	rd, err := gzip.NewReader(bytes.NewReader(data))
-	if err != nil {
-		return []byte{}, err
+// Tracks the archive entries seen while listing or extracting a bundle and checks
+// them against the bundle limits
+type entryLimiter struct {
+	limits config.BundleLimits
+	entries int
+	totalSize int64
+}
+
+func newEntryLimiter(limits config.BundleLimits) *entryLimiter {
+	return &entryLimiter{limits: limits}
+}
+
+func (limiter *entryLimiter) check(entryPath string, size int64) error {
+	limiter.entries += 1
+	if limiter.limits.Entries > 0 && limiter.entries > limiter.limits.Entries {
+		return fmt.Errorf("%w: bundle contains more than %d entries", ErrLimitExceeded, limiter.limits.Entries)
+	}
+
+	depth := len(strings.Split(path.Clean(entryPath), "/"))
+	if limiter.limits.PathDepth > 0 && depth > limiter.limits.PathDepth {
+		return fmt.Errorf("%w: path %s is nested deeper than %d directories", ErrLimitExceeded, entryPath, limiter.limits.PathDepth)
 	}
 
-	return io.ReadAll(rd)
+	if limiter.limits.FileSize > 0 && size > limiter.limits.FileSize {
+		return fmt.Errorf("%w: file %s is larger than %d bytes", ErrLimitExceeded, entryPath, limiter.limits.FileSize)
+	}
+
+	limiter.totalSize += size
+	if limiter.limits.DecompressedSize > 0 && limiter.totalSize > limiter.limits.DecompressedSize {
+		return fmt.Errorf("%w: extracted files are larger than %d bytes", ErrLimitExceeded, limiter.limits.DecompressedSize)
+	}
+
+	return nil
 }
 
+// Copies a file from an archive and returns an error if it is larger than the
+// expected size
+func copyEntry(dst io.Writer, src io.Reader, entryPath string, size int64) error {
+	if w, err := io.Copy(dst, io.LimitReader(src, size+1)); err != nil {
+		return err
+	} else if w > size {
+		return fmt.Errorf("file %s is larger than the size in its archive header", entryPath)
+	} else if w != size {
+		return fmt.Errorf("file write for %s truncated", entryPath)
+	}
 
-func extractorForMimeType(mimeType string, bundle []byte) (BundleExtractor, error) {
-	if mimeType == mimeTypeZip {
-		return NewZipExtractor(bundle), nil
+	return nil
+}
+
+// Creates the directory and any missing parent directories inside the root
+func mkdirAll(root *os.Root, dirPath string) error {
+	if dirPath == "." || dirPath == "/" {
+		return nil
+	}
+
+	if info, err := root.Stat(dirPath); err == nil {
+		if !info.IsDir() {
+			return fmt.Errorf("%s exists and is not a directory", dirPath)
+		}
+
+		return nil
 	}
 
-	decompressMimeTypes := map[string]func([]byte) ([]byte, error){
-		mimeTypeXz: decompressXz,
-		mimeTypeBzip2: decompressBzip2,
-		mimeTypeGzip: decompressGzip,
+	if err := mkdirAll(root, path.Dir(dirPath)); err != nil {
+		return err
 	}
 
-	if decompressor, ok := decompressMimeTypes[mimeType]; ok {
-		bundle, err := decompressor(bundle)
+	if err := root.Mkdir(dirPath, 0700); err != nil && !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+
+	return nil
+}
+
+// Creates the missing parent directories for the file path inside the root
+func mkdirParents(root *os.Root, filePath string) error {
+	return mkdirAll(root, path.Dir(filePath))
+}
+
+// Returns the permissions for an extracted file. Archives which do not store
+// permissions are extracted as readable and writable by the owner
+func fileModeOrDefault(mode fs.FileMode) fs.FileMode {
+	if mode.Perm() == 0 {
+		return 0600
+	}
+
+	return mode.Perm()
+}
+
+// Wraps a decompressed stream and returns an error once more than limit bytes
+// have been read from it
+type sizeLimitReader struct {
+	rd io.Reader
+	limit int64
+	read int64
+}
+
+func newSizeLimitReader(rd io.Reader, limit int64) *sizeLimitReader {
+	return &sizeLimitReader{rd: rd, limit: limit}
+}
+
+func (rd *sizeLimitReader) Read(p []byte) (int, error) {
+	n, err := rd.rd.Read(p)
+	rd.read += int64(n)
+	if rd.limit > 0 && rd.read > rd.limit {
+		return n, fmt.Errorf("%w: decompressed bundle is larger than %d bytes", ErrLimitExceeded, rd.limit)
+	}
+
+	return n, err
+}
+
+func decompressXz(rd io.Reader) (io.ReadCloser, error) {
+	xzRd, err := xz.NewReader(rd)
+	if err != nil {
+		return nil, err
+	}
+
+	return io.NopCloser(xzRd), nil
+}
+
+func decompressZstd(rd io.Reader) (io.ReadCloser, error) {
+	zstdRd, err := zstd.NewReader(rd, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+
+	return zstdRd.IOReadCloser(), nil
+}
+
+func decompressBzip2(rd io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(bzip2.NewReader(rd)), nil
+}
+
+func decompressGzip(rd io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(rd)
+}
+
+var decompressMimeTypes = map[string]func(io.Reader) (io.ReadCloser, error){
+	mimeTypeXz: decompressXz,
+	mimeTypeBzip2: decompressBzip2,
+	mimeTypeGzip: decompressGzip,
+	mimeTypeZstd: decompressZstd,
+}
+
+// Extracts an archive wrapped in one or more compression layers. The layers are
+// decompressed while the archive is being extracted
+type compressedExtractor struct {
+	bundle io.Reader
+	mimeType string
+	limits config.BundleLimits
+}
+
+func (extractor compressedExtractor) ExtractTo(root *os.Root) ([]string, error) {
+	rd := extractor.bundle
+	mimeType := extractor.mimeType
+
+	for layer := 0; ; layer++ {
+		decompressor, ok := decompressMimeTypes[mimeType]
+		if !ok {
+			break
+		}
+
+		if layer >= maxCompressionLayers {
+			return nil, fmt.Errorf("%w: bundle is compressed more than %d times", ErrLimitExceeded, maxCompressionLayers)
+		}
+
+		decompressed, err := decompressor(rd)
 		if err != nil {
 			return nil, err
 		}
+		defer decompressed.Close()
 
-		mimeType, err = detectMimeType(bundle)
+		buffered := bufio.NewReader(newSizeLimitReader(decompressed, extractor.limits.DecompressedSize))
+		mimeType, err = detectStreamMimeType(buffered)
 		if err != nil {
 			return nil, err
 		}
 
-		return extractorForMimeType(mimeType, bundle)
-	} else if mimeType == mimeTypeTar {
-		return NewTarExtractor(bundle), nil
+		rd = buffered
+	}
+
+	switch mimeType {
+	case mimeTypeTar:
+		return NewTarExtractor(rd, extractor.limits).ExtractTo(root)
+	case mimeTypeZip:
+		return extractSpooledZip(root, rd, extractor.limits)
 	}
 
 	return nil, fmt.Errorf("unknown file type %s", mimeType)
 }
 
-func NewBundleExtractor(bundle []byte) (BundleExtractor, error) {
-	mimeType, err := detectMimeType(bundle)
+// Zip archives need random access so a zip archive inside of a compression layer
+// is written to a temporary file while it is extracted
+func extractSpooledZip(root *os.Root, rd io.Reader, limits config.BundleLimits) ([]string, error) {
+	spoolFile, err := os.CreateTemp("", "forgescript-bundle-*.zip")
 	if err != nil {
 		return nil, err
 	}
+	defer os.Remove(spoolFile.Name())
+	defer spoolFile.Close()
 
-	return extractorForMimeType(mimeType, bundle)
+	size, err := io.Copy(spoolFile, rd)
+	if err != nil {
+		return nil, err
+	}
+
+	zipx, err := NewZipExtractor(spoolFile, size, limits)
+	if err != nil {
+		return nil, err
+	}
+
+	return zipx.ExtractTo(root)
 }
 
+// Returns an extractor for the bundle. Only the leading bytes of the bundle are read
+// until the bundle is extracted. The file name is used as the script name when the
+// bundle is a single Python script
+func NewBundleExtractor(bundle io.ReaderAt, size int64, fileName string, limits config.BundleLimits) (BundleExtractor, error) {
+	if limits.CompressedSize > 0 && size > limits.CompressedSize {
+		return nil, fmt.Errorf("%w: bundle is larger than %d bytes", ErrLimitExceeded, limits.CompressedSize)
+	}
+
+	sample := make([]byte, min(size, detectSize+1))
+	if n, err := bundle.ReadAt(sample, 0); n < len(sample) {
+		return nil, err
+	}
+
+	mimeType, err := detectMimeType(sample)
+	if err != nil {
+		return nil, err
+	}
+
+	if mimeType == mimeTypeZip {
+		return NewZipExtractor(bundle, size, limits)
+	} else if mimeType == mimeTypeTar {
+		return NewTarExtractor(io.NewSectionReader(bundle, 0, size), limits), nil
+	} else if isScriptBundle(mimeType, fileName) {
+		return NewScriptExtractor(io.NewSectionReader(bundle, 0, size), size, fileName, limits), nil
+	} else if _, ok := decompressMimeTypes[mimeType]; ok {
+		return compressedExtractor{
+			bundle: io.NewSectionReader(bundle, 0, size),
+			mimeType: mimeType,
+			limits: limits,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown file type %s", mimeType)
+}
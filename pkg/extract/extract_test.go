@@ -4,9 +4,17 @@ import (
 	"archive/tar"
 	"archive/zip"
 	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
 	"testing"
 
+	"github.com/MythicAgents/forgescript/pkg/config"
+	"github.com/klauspost/compress/zstd"
 	"github.com/stretchr/testify/assert"
+	"github.com/ulikunitz/xz"
 )
 
 const (
@@ -19,6 +27,78 @@ func TestDetectMimeType(t *testing.T) {
 	assert.Equal(t, "text/plain", mimeType)
 }
 
+func TestDetectMimeTypeMagic(t *testing.T) {
+	var zipBuf bytes.Buffer
+	zipw := zip.NewWriter(&zipBuf)
+	_, err := zipw.Create("file.py")
+	assert.Nil(t, err, "failed creating file.py in test zip file")
+	assert.Nil(t, zipw.Close(), "failed creating test zip file")
+
+	var gzipBuf bytes.Buffer
+	gzipw := gzip.NewWriter(&gzipBuf)
+	gzipw.Write([]byte("data"))
+	assert.Nil(t, gzipw.Close(), "failed creating test gzip file")
+
+	var gnuTarBuf bytes.Buffer
+	gnuTarw := tar.NewWriter(&gnuTarBuf)
+	assert.Nil(t, gnuTarw.WriteHeader(&tar.Header{
+		Name:   "file.py",
+		Format: tar.FormatGNU,
+	}), "failed writing GNU tar header")
+	assert.Nil(t, gnuTarw.Close(), "failed creating GNU tar file")
+
+	tests := map[string]struct {
+		data     []byte
+		mimeType string
+	}{
+		"gzip":   {gzipBuf.Bytes(), mimeTypeGzip},
+		"bzip2":  {[]byte("BZh91AY&SY"), mimeTypeBzip2},
+		"xz":     {[]byte{0xfd, '7', 'z', 'X', 'Z', 0x00, 0x00, 0x04}, mimeTypeXz},
+		"zstd":   {[]byte{0x28, 0xb5, 0x2f, 0xfd, 0x04, 0x00}, mimeTypeZstd},
+		"zip":    {zipBuf.Bytes(), mimeTypeZip},
+		"ustar":  {createTestTarBundle(t), mimeTypeTar},
+		"gnutar": {gnuTarBuf.Bytes(), mimeTypeTar},
+		"python": {[]byte("# Alias script\nimport forgescript\n"), mimeTypePython},
+		"binary": {[]byte{0x7f, 'E', 'L', 'F', 0x00}, mimeTypeUnknown},
+	}
+
+	for name, test := range tests {
+		mimeType, err := detectMimeType(test.data)
+		assert.Nil(t, err, "detectMimeType returned an error for %s", name)
+		assert.Equal(t, test.mimeType, mimeType, "detectMimeType returned the wrong type for %s", name)
+	}
+}
+
+func TestDetectMimeTypeEmpty(t *testing.T) {
+	_, err := detectMimeType([]byte{})
+	assert.NotNil(t, err, "detectMimeType did not return an error for empty data")
+}
+
+func extractTestBundle(t *testing.T, bundle []byte, limits config.BundleLimits) ([]string, error) {
+	extractor, err := NewBundleExtractor(bytes.NewReader(bundle), int64(len(bundle)), "bundle", limits)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := os.OpenRoot(t.TempDir())
+	assert.Nil(t, err, "failed opening extraction root")
+	defer root.Close()
+
+	return extractor.ExtractTo(root)
+}
+
+func TestGzipTarBundle(t *testing.T) {
+	var gzipBuf bytes.Buffer
+	gzipw := gzip.NewWriter(&gzipBuf)
+	_, err := gzipw.Write(createTestTarBundle(t))
+	assert.Nil(t, err, "failed compressing test tar file")
+	assert.Nil(t, gzipw.Close(), "failed creating test gzip file")
+
+	fileList, err := extractTestBundle(t, gzipBuf.Bytes(), config.GetBundleLimits())
+	assert.Nil(t, err, "ExtractTo() returned an error")
+	assert.Contains(t, fileList, "forgescript_alias.py", "extractor did not extract test file in gzip bundle")
+}
+
 func TestTarListFiles(t *testing.T) {
 	var tarBuf bytes.Buffer
 	tarw := tar.NewWriter(&tarBuf)
@@ -29,10 +109,9 @@ func TestTarListFiles(t *testing.T) {
 
 	assert.Nil(t, tarw.Close(), "failed creating test tar file")
 
-	tarx := NewTarExtractor(tarBuf.Bytes())
-	fileList, err := tarx.ListFilePaths()
-	assert.Nil(t, err, "ListFiles() returned an error")
-	assert.Contains(t, fileList, "file.py", "tar extractor could not list test file")
+	fileList, err := extractTestBundle(t, tarBuf.Bytes(), config.GetBundleLimits())
+	assert.Nil(t, err, "ExtractTo() returned an error")
+	assert.Contains(t, fileList, "file.py", "tar extractor did not list test file")
 }
 
 func TestTarListFilesSubdir(t *testing.T) {
@@ -45,10 +124,9 @@ func TestTarListFilesSubdir(t *testing.T) {
 
 	assert.Nil(t, tarw.Close(), "failed creating test tar file")
 
-	tarx := NewTarExtractor(tarBuf.Bytes())
-	fileList, err := tarx.ListFilePaths()
-	assert.Nil(t, err, "ListFiles() returned an error")
-	assert.Contains(t, fileList, "subdir/file.py", "tar extractor could not list test file")
+	fileList, err := extractTestBundle(t, tarBuf.Bytes(), config.GetBundleLimits())
+	assert.Nil(t, err, "ExtractTo() returned an error")
+	assert.Contains(t, fileList, "subdir/file.py", "tar extractor did not list test file")
 }
 
 func TestZipListFiles(t *testing.T) {
@@ -60,8 +138,467 @@ func TestZipListFiles(t *testing.T) {
 
 	assert.NotEqual(t, 0, len(zipBuf.Bytes()), "zip writer did not write any data")
 
-	zipx := NewZipExtractor(zipBuf.Bytes())
-	fileList, err := zipx.ListFilePaths()
-	assert.Nil(t, err, "ListFiles() returned an error")
-	assert.Contains(t, fileList, "file.py", "zip extractor could not list test file")
+	fileList, err := extractTestBundle(t, zipBuf.Bytes(), config.GetBundleLimits())
+	assert.Nil(t, err, "ExtractTo() returned an error")
+	assert.Contains(t, fileList, "file.py", "zip extractor did not list test file")
+}
+
+func TestZipExtract(t *testing.T) {
+	var zipBuf bytes.Buffer
+	zipw := zip.NewWriter(&zipBuf)
+
+	stored, err := zipw.CreateHeader(&zip.FileHeader{
+		Name:   "forgescript_alias.py",
+		Method: zip.Store,
+	})
+	assert.Nil(t, err, "failed creating stored file in test zip file")
+	stored.Write([]byte("import forgescript\n"))
+
+	deflated, err := zipw.CreateHeader(&zip.FileHeader{
+		Name:   "bin/x64/whoami.o",
+		Method: zip.Deflate,
+	})
+	assert.Nil(t, err, "failed creating deflated file in test zip file")
+	deflated.Write(bytes.Repeat([]byte("A"), 4096))
+
+	_, err = zipw.Create("empty/")
+	assert.Nil(t, err, "failed creating directory in test zip file")
+
+	execHdr := &zip.FileHeader{Name: "bin/run.sh", Method: zip.Deflate}
+	execHdr.SetMode(0750)
+	executable, err := zipw.CreateHeader(execHdr)
+	assert.Nil(t, err, "failed creating executable file in test zip file")
+	executable.Write([]byte("#!/bin/sh\n"))
+
+	assert.Nil(t, zipw.Close(), "failed creating test zip file")
+
+	root, err := os.OpenRoot(t.TempDir())
+	assert.Nil(t, err, "failed opening extraction root")
+	defer root.Close()
+
+	zipx, err := NewZipExtractor(bytes.NewReader(zipBuf.Bytes()), int64(zipBuf.Len()), config.GetBundleLimits())
+	assert.Nil(t, err, "NewZipExtractor() returned an error")
+
+	fileList, err := zipx.ExtractTo(root)
+	assert.Nil(t, err, "ExtractTo() returned an error")
+	assert.ElementsMatch(t, []string{"forgescript_alias.py", "bin/x64/whoami.o", "bin/run.sh"}, fileList)
+
+	content, err := fs.ReadFile(root.FS(), "forgescript_alias.py")
+	assert.Nil(t, err, "stored file was not extracted")
+	assert.Equal(t, "import forgescript\n", string(content))
+
+	content, err = fs.ReadFile(root.FS(), "bin/x64/whoami.o")
+	assert.Nil(t, err, "deflated file in nested directory was not extracted")
+	assert.Equal(t, bytes.Repeat([]byte("A"), 4096), content)
+
+	info, err := root.Stat("empty")
+	assert.Nil(t, err, "directory entry was not extracted")
+	assert.True(t, info.IsDir(), "directory entry was not extracted as a directory")
+
+	info, err = root.Stat("bin/run.sh")
+	assert.Nil(t, err, "executable file was not extracted")
+	assert.Equal(t, fs.FileMode(0750), info.Mode().Perm())
+}
+
+func TestZipExtractPathTraversal(t *testing.T) {
+	for _, name := range []string{"../escape.py", "/abs/escape.py", "sub/../../escape.py"} {
+		var zipBuf bytes.Buffer
+		zipw := zip.NewWriter(&zipBuf)
+		_, err := zipw.Create(name)
+		assert.Nil(t, err, "failed creating %s in test zip file", name)
+		assert.Nil(t, zipw.Close(), "failed creating test zip file")
+
+		tempDir := t.TempDir()
+		root, err := os.OpenRoot(tempDir)
+		assert.Nil(t, err, "failed opening extraction root")
+
+		zipx, err := NewZipExtractor(bytes.NewReader(zipBuf.Bytes()), int64(zipBuf.Len()), config.GetBundleLimits())
+		assert.Nil(t, err, "NewZipExtractor() returned an error")
+
+		_, err = zipx.ExtractTo(root)
+		assert.NotNil(t, err, "ExtractTo() extracted %s", name)
+		root.Close()
+
+		_, err = os.Stat(path.Join(path.Dir(tempDir), "escape.py"))
+		assert.True(t, os.IsNotExist(err), "%s was extracted outside of the root", name)
+	}
+}
+
+func TestZipOpen(t *testing.T) {
+	var zipBuf bytes.Buffer
+	zipw := zip.NewWriter(&zipBuf)
+	script, err := zipw.Create("forgescript_alias.py")
+	assert.Nil(t, err, "failed creating script in test zip file")
+	script.Write([]byte("import forgescript\n"))
+	assert.Nil(t, zipw.Close(), "failed creating test zip file")
+
+	bundle, err := NewBundleExtractor(bytes.NewReader(zipBuf.Bytes()), int64(zipBuf.Len()), "bundle.zip", config.GetBundleLimits())
+	assert.Nil(t, err, "NewBundleExtractor() returned an error")
+
+	archive, ok := bundle.(ArchiveBundle)
+	assert.True(t, ok, "zip bundle cannot be read in place")
+
+	bundleFiles, err := archive.Open()
+	assert.Nil(t, err, "Open() returned an error")
+
+	content, err := fs.ReadFile(bundleFiles, "forgescript_alias.py")
+	assert.Nil(t, err, "script could not be read from the archive")
+	assert.Equal(t, "import forgescript\n", string(content))
+
+	tarGz := createTestTarBundle(t)
+	tarBundle, err := NewBundleExtractor(bytes.NewReader(tarGz), int64(len(tarGz)), "bundle.tar.gz", config.GetBundleLimits())
+	assert.Nil(t, err, "NewBundleExtractor() returned an error")
+
+	_, ok = tarBundle.(ArchiveBundle)
+	assert.False(t, ok, "compressed tar bundle can be read in place")
+}
+
+func TestZipOpenRejected(t *testing.T) {
+	var zipBuf bytes.Buffer
+	zipw := zip.NewWriter(&zipBuf)
+	_, err := zipw.Create("../escape.py")
+	assert.Nil(t, err, "failed creating ../escape.py in test zip file")
+	assert.Nil(t, zipw.Close(), "failed creating test zip file")
+
+	zipx, err := NewZipExtractor(bytes.NewReader(zipBuf.Bytes()), int64(zipBuf.Len()), config.GetBundleLimits())
+	assert.Nil(t, err, "NewZipExtractor() returned an error")
+
+	_, err = zipx.Open()
+	assert.NotNil(t, err, "Open() accepted an entry outside of the bundle")
+
+	zipBuf.Reset()
+	zipw = zip.NewWriter(&zipBuf)
+	for _, name := range []string{"a.py", "b.py", "c.py"} {
+		_, err := zipw.Create(name)
+		assert.Nil(t, err, "failed creating %s in test zip file", name)
+	}
+	assert.Nil(t, zipw.Close(), "failed creating test zip file")
+
+	limits := config.GetBundleLimits()
+	limits.Entries = 2
+
+	zipx, err = NewZipExtractor(bytes.NewReader(zipBuf.Bytes()), int64(zipBuf.Len()), limits)
+	assert.Nil(t, err, "NewZipExtractor() returned an error")
+
+	_, err = zipx.Open()
+	assert.ErrorIs(t, err, ErrLimitExceeded, "Open() did not enforce the bundle limits")
+}
+
+func createTestTarBundle(t *testing.T) []byte {
+	var tarBuf bytes.Buffer
+	tarw := tar.NewWriter(&tarBuf)
+
+	content := []byte("import forgescript\n")
+	assert.Nil(t, tarw.WriteHeader(&tar.Header{
+		Name: "forgescript_alias.py",
+		Mode: 0600,
+		Size: int64(len(content)),
+	}), "failed writing test tar header")
+
+	_, err := tarw.Write(content)
+	assert.Nil(t, err, "failed writing test tar file content")
+	assert.Nil(t, tarw.Close(), "failed creating test tar file")
+
+	return tarBuf.Bytes()
+}
+
+func TestXzTarBundle(t *testing.T) {
+	var xzBuf bytes.Buffer
+	xzw, err := xz.NewWriter(&xzBuf)
+	assert.Nil(t, err, "failed creating xz writer")
+	_, err = xzw.Write(createTestTarBundle(t))
+	assert.Nil(t, err, "failed compressing test tar file")
+	assert.Nil(t, xzw.Close(), "failed creating test xz file")
+
+	fileList, err := extractTestBundle(t, xzBuf.Bytes(), config.GetBundleLimits())
+	assert.Nil(t, err, "ExtractTo() returned an error")
+	assert.Contains(t, fileList, "forgescript_alias.py", "extractor did not extract test file in xz bundle")
+}
+
+func TestZstdTarBundle(t *testing.T) {
+	var zstdBuf bytes.Buffer
+	zstdw, err := zstd.NewWriter(&zstdBuf)
+	assert.Nil(t, err, "failed creating zstd writer")
+	_, err = zstdw.Write(createTestTarBundle(t))
+	assert.Nil(t, err, "failed compressing test tar file")
+	assert.Nil(t, zstdw.Close(), "failed creating test zstd file")
+
+	fileList, err := extractTestBundle(t, zstdBuf.Bytes(), config.GetBundleLimits())
+	assert.Nil(t, err, "ExtractTo() returned an error")
+	assert.Contains(t, fileList, "forgescript_alias.py", "extractor did not extract test file in zstd bundle")
+}
+
+func TestBundleLimits(t *testing.T) {
+	var tarBuf bytes.Buffer
+	tarw := tar.NewWriter(&tarBuf)
+	for _, name := range []string{"a.py", "b/c.py", "d/e/f/g.py"} {
+		content := bytes.Repeat([]byte("#"), 100)
+		assert.Nil(t, tarw.WriteHeader(&tar.Header{
+			Name: name,
+			Mode: 0600,
+			Size: int64(len(content)),
+		}), "failed writing test tar header")
+		tarw.Write(content)
+	}
+	assert.Nil(t, tarw.Close(), "failed creating test tar file")
+
+	tests := map[string]config.BundleLimits{
+		"entries":     {Entries: 2},
+		"path depth":  {PathDepth: 3},
+		"file size":   {FileSize: 99},
+		"total size":  {DecompressedSize: 250},
+		"bundle size": {CompressedSize: 1024},
+	}
+
+	for name, limits := range tests {
+		_, err := extractTestBundle(t, tarBuf.Bytes(), limits)
+		assert.ErrorIs(t, err, ErrLimitExceeded, "%s limit was not enforced", name)
+	}
+
+	fileList, err := extractTestBundle(t, tarBuf.Bytes(), config.BundleLimits{})
+	assert.Nil(t, err, "ExtractTo() returned an error without limits")
+	assert.Len(t, fileList, 3)
+}
+
+func TestDecompressionBomb(t *testing.T) {
+	var gzipBuf bytes.Buffer
+	gzipw := gzip.NewWriter(&gzipBuf)
+	gzipw.Write(createTestTarEntries(t, []testTarEntry{
+		{hdr: tar.Header{Name: "bomb.py", Typeflag: tar.TypeReg, Mode: 0600}, content: string(make([]byte, 1<<20))},
+	}))
+	assert.Nil(t, gzipw.Close(), "failed creating test gzip file")
+
+	_, err := extractTestBundle(t, gzipBuf.Bytes(), config.BundleLimits{DecompressedSize: 1 << 16})
+	assert.ErrorIs(t, err, ErrLimitExceeded, "decompressed size limit was not enforced")
+}
+
+func TestCompressedZipBundle(t *testing.T) {
+	var zipBuf bytes.Buffer
+	zipw := zip.NewWriter(&zipBuf)
+	zipFile, err := zipw.CreateHeader(&zip.FileHeader{Name: "forgescript_alias.py", Method: zip.Store})
+	assert.Nil(t, err, "failed creating file in test zip file")
+	zipFile.Write(make([]byte, 1<<20))
+	assert.Nil(t, zipw.Close(), "failed creating test zip file")
+
+	var gzipBuf bytes.Buffer
+	gzipw := gzip.NewWriter(&gzipBuf)
+	gzipw.Write(zipBuf.Bytes())
+	assert.Nil(t, gzipw.Close(), "failed creating test gzip file")
+
+	fileList, err := extractTestBundle(t, gzipBuf.Bytes(), config.GetBundleLimits())
+	assert.Nil(t, err, "ExtractTo() returned an error")
+	assert.Equal(t, []string{"forgescript_alias.py"}, fileList)
+
+	_, err = extractTestBundle(t, gzipBuf.Bytes(), config.BundleLimits{DecompressedSize: 1 << 16})
+	assert.ErrorIs(t, err, ErrLimitExceeded, "decompressed size limit was not enforced for a compressed zip file")
+}
+
+func TestNestedCompressionLayers(t *testing.T) {
+	bundle := createTestTarBundle(t)
+	for range maxCompressionLayers + 1 {
+		var gzipBuf bytes.Buffer
+		gzipw := gzip.NewWriter(&gzipBuf)
+		gzipw.Write(bundle)
+		assert.Nil(t, gzipw.Close(), "failed creating test gzip file")
+		bundle = gzipBuf.Bytes()
+	}
+
+	_, err := extractTestBundle(t, bundle, config.GetBundleLimits())
+	assert.ErrorIs(t, err, ErrLimitExceeded, "compression layer limit was not enforced")
+}
+
+type testTarEntry struct {
+	hdr     tar.Header
+	content string
+}
+
+func createTestTarEntries(t *testing.T, entries []testTarEntry) []byte {
+	var tarBuf bytes.Buffer
+	tarw := tar.NewWriter(&tarBuf)
+
+	for _, entry := range entries {
+		entry.hdr.Size = int64(len(entry.content))
+		assert.Nil(t, tarw.WriteHeader(&entry.hdr), "failed writing test tar header for %s", entry.hdr.Name)
+		_, err := tarw.Write([]byte(entry.content))
+		assert.Nil(t, err, "failed writing test tar file content for %s", entry.hdr.Name)
+	}
+
+	assert.Nil(t, tarw.Close(), "failed creating test tar file")
+	return tarBuf.Bytes()
+}
+
+func extractTestTar(t *testing.T, bundle []byte) (string, error) {
+	tempDir := t.TempDir()
+	root, err := os.OpenRoot(tempDir)
+	assert.Nil(t, err, "failed opening extraction root")
+	defer root.Close()
+
+	_, err = NewTarExtractor(bytes.NewReader(bundle), config.GetBundleLimits()).ExtractTo(root)
+	return tempDir, err
+}
+
+func TestTarExtractDirectories(t *testing.T) {
+	bundle := createTestTarEntries(t, []testTarEntry{
+		{hdr: tar.Header{Name: "lib/", Typeflag: tar.TypeDir, Mode: 0700}},
+		{hdr: tar.Header{Name: "lib/nested/deep/", Typeflag: tar.TypeDir, Mode: 0700}},
+		{hdr: tar.Header{Name: "lib/nested/deep/util.py", Typeflag: tar.TypeReg, Mode: 0600}, content: "x = 1\n"},
+		{hdr: tar.Header{Name: "other/dir/file.py", Typeflag: tar.TypeReg, Mode: 0600}, content: "y = 2\n"},
+	})
+
+	fileList, err := extractTestBundle(t, bundle, config.GetBundleLimits())
+	assert.Nil(t, err, "ExtractTo() returned an error")
+	assert.ElementsMatch(t, []string{"lib/nested/deep/util.py", "other/dir/file.py"}, fileList, "directories should not be listed as files")
+
+	tempDir, err := extractTestTar(t, bundle)
+	assert.Nil(t, err, "ExtractTo() returned an error")
+
+	info, err := os.Stat(path.Join(tempDir, "lib/nested/deep"))
+	assert.Nil(t, err, "directory entry was not extracted")
+	assert.True(t, info.IsDir(), "directory entry was not extracted as a directory")
+
+	content, err := os.ReadFile(path.Join(tempDir, "other/dir/file.py"))
+	assert.Nil(t, err, "file in a directory without a directory entry was not extracted")
+	assert.Equal(t, "y = 2\n", string(content))
+}
+
+func TestTarExtractLinks(t *testing.T) {
+	bundle := createTestTarEntries(t, []testTarEntry{
+		{hdr: tar.Header{Name: "lib/util.py", Typeflag: tar.TypeReg, Mode: 0600}, content: "x = 1\n"},
+		{hdr: tar.Header{Name: "lib/alias.py", Typeflag: tar.TypeSymlink, Linkname: "util.py"}},
+		{hdr: tar.Header{Name: "util_link.py", Typeflag: tar.TypeSymlink, Linkname: "lib/util.py"}},
+		{hdr: tar.Header{Name: "hardlink.py", Typeflag: tar.TypeLink, Linkname: "lib/util.py"}},
+	})
+
+	fileList, err := extractTestBundle(t, bundle, config.GetBundleLimits())
+	assert.Nil(t, err, "ExtractTo() returned an error")
+	assert.ElementsMatch(t, []string{"lib/util.py", "lib/alias.py", "util_link.py", "hardlink.py"}, fileList)
+
+	tempDir, err := extractTestTar(t, bundle)
+	assert.Nil(t, err, "ExtractTo() returned an error")
+
+	for _, name := range []string{"lib/alias.py", "util_link.py", "hardlink.py"} {
+		info, err := os.Lstat(path.Join(tempDir, name))
+		assert.Nil(t, err, "link %s was not extracted", name)
+		assert.True(t, info.Mode().IsRegular(), "link %s was not extracted as a regular file", name)
+
+		content, err := os.ReadFile(path.Join(tempDir, name))
+		assert.Nil(t, err, "could not read extracted link %s", name)
+		assert.Equal(t, "x = 1\n", string(content))
+	}
+}
+
+func TestTarExtractLinksEntryLimit(t *testing.T) {
+	entries := []testTarEntry{
+		{hdr: tar.Header{Name: "util.py", Typeflag: tar.TypeReg, Mode: 0600}, content: "x = 1\n"},
+	}
+
+	for i := range 3 {
+		entries = append(entries, testTarEntry{hdr: tar.Header{Name: fmt.Sprintf("link%d.py", i), Typeflag: tar.TypeSymlink, Linkname: "util.py"}})
+	}
+
+	bundle := createTestTarEntries(t, entries)
+
+	fileList, err := extractTestBundle(t, bundle, config.BundleLimits{Entries: len(entries)})
+	assert.Nil(t, err, "links were counted more than once against the entry limit")
+	assert.Len(t, fileList, len(entries))
+
+	_, err = extractTestBundle(t, bundle, config.BundleLimits{Entries: len(entries) - 1})
+	assert.ErrorIs(t, err, ErrLimitExceeded, "entry limit was not enforced for links")
+}
+
+func TestTarExtractLinksOutsideRoot(t *testing.T) {
+	for _, hdr := range []tar.Header{
+		{Name: "escape.py", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"},
+		{Name: "escape.py", Typeflag: tar.TypeSymlink, Linkname: "../../etc/passwd"},
+		{Name: "lib/escape.py", Typeflag: tar.TypeSymlink, Linkname: "../../outside.py"},
+		{Name: "escape.py", Typeflag: tar.TypeLink, Linkname: "../outside.py"},
+		{Name: "missing.py", Typeflag: tar.TypeLink, Linkname: "missing_target.py"},
+	} {
+		bundle := createTestTarEntries(t, []testTarEntry{{hdr: hdr}})
+
+		tempDir, err := extractTestTar(t, bundle)
+		assert.NotNil(t, err, "ExtractTo() extracted link %s -> %s", hdr.Name, hdr.Linkname)
+
+		_, err = os.Lstat(path.Join(tempDir, hdr.Name))
+		assert.True(t, os.IsNotExist(err), "link %s -> %s was extracted", hdr.Name, hdr.Linkname)
+	}
+}
+
+func TestTarExtractLinkToDirectory(t *testing.T) {
+	bundle := createTestTarEntries(t, []testTarEntry{
+		{hdr: tar.Header{Name: "lib/", Typeflag: tar.TypeDir, Mode: 0700}},
+		{hdr: tar.Header{Name: "lib_link", Typeflag: tar.TypeSymlink, Linkname: "lib"}},
+	})
+
+	_, err := extractTestTar(t, bundle)
+	assert.NotNil(t, err, "ExtractTo() extracted a link to a directory")
+}
+
+func TestTarSpecialFiles(t *testing.T) {
+	for _, typeflag := range []byte{tar.TypeChar, tar.TypeBlock, tar.TypeFifo} {
+		bundle := createTestTarEntries(t, []testTarEntry{
+			{hdr: tar.Header{Name: "special", Typeflag: typeflag, Mode: 0600}},
+		})
+
+		tempDir, err := extractTestTar(t, bundle)
+		assert.NotNil(t, err, "ExtractTo() accepted entry type '%c'", typeflag)
+
+		_, err = os.Lstat(path.Join(tempDir, "special"))
+		assert.True(t, os.IsNotExist(err), "special file with type '%c' was extracted", typeflag)
+	}
+}
+
+func TestTarExtractPathTraversal(t *testing.T) {
+	for _, name := range []string{"../escape.py", "/abs/escape.py", "sub/../../escape.py"} {
+		bundle := createTestTarEntries(t, []testTarEntry{
+			{hdr: tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0600}, content: "x = 1\n"},
+		})
+
+		tempDir, err := extractTestTar(t, bundle)
+		assert.NotNil(t, err, "ExtractTo() extracted %s", name)
+
+		_, err = os.Stat(path.Join(path.Dir(tempDir), "escape.py"))
+		assert.True(t, os.IsNotExist(err), "%s was extracted outside of the root", name)
+	}
+}
+
+func TestScriptBundle(t *testing.T) {
+	script := []byte("import forgescript\n")
+
+	extractor, err := NewBundleExtractor(bytes.NewReader(script), int64(len(script)), "whoami.py", config.GetBundleLimits())
+	assert.Nil(t, err, "NewBundleExtractor() returned an error for a Python script")
+
+	scriptx, ok := extractor.(ScriptExtractor)
+	assert.True(t, ok, "Python script was not detected as a script bundle")
+	assert.Equal(t, "whoami.py", scriptx.ScriptName())
+
+	tempDir := t.TempDir()
+	root, err := os.OpenRoot(tempDir)
+	assert.Nil(t, err, "failed opening extraction root")
+	defer root.Close()
+
+	fileList, err := extractor.ExtractTo(root)
+	assert.Nil(t, err, "ExtractTo() returned an error")
+	assert.Equal(t, []string{"whoami.py"}, fileList)
+
+	content, err := os.ReadFile(path.Join(tempDir, "whoami.py"))
+	assert.Nil(t, err, "script was not extracted")
+	assert.Equal(t, script, content)
+}
+
+func TestScriptBundleFileName(t *testing.T) {
+	script := []byte("x = 1\n")
+
+	_, err := NewBundleExtractor(bytes.NewReader(script), int64(len(script)), "notes.txt", config.GetBundleLimits())
+	assert.NotNil(t, err, "text file without a .py extension was accepted as a script")
+
+	for fileName, scriptName := range map[string]string{
+		"alias.py":           "alias.py",
+		"../../alias.py":     "alias.py",
+		"C:\\temp\\alias.py": "alias.py",
+		"..":                 defaultScriptName,
+	} {
+		extractor := NewScriptExtractor(bytes.NewReader(script), int64(len(script)), fileName, config.GetBundleLimits())
+		assert.Equal(t, scriptName, extractor.ScriptName(), "unexpected script name for %s", fileName)
+	}
 }
@@ -0,0 +1,64 @@
+package extract
+
+import (
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/MythicAgents/forgescript/pkg/config"
+)
+
+// Name used for a script bundle when the uploaded file name is not usable
+const defaultScriptName = "forgescript_alias.py"
+
+// Extracts a bundle which is a single Python script. The script is the entry script
+// of the bundle
+type ScriptExtractor struct {
+	rd         io.Reader
+	size       int64
+	scriptName string
+	limits     config.BundleLimits
+}
+
+func NewScriptExtractor(rd io.Reader, size int64, fileName string, limits config.BundleLimits) ScriptExtractor {
+	scriptName := path.Base(strings.ReplaceAll(fileName, "\\", "/"))
+	if scriptName == "." || scriptName == "/" || scriptName == ".." {
+		scriptName = defaultScriptName
+	}
+
+	return ScriptExtractor{rd: rd, size: size, scriptName: scriptName, limits: limits}
+}
+
+// Returns the path of the script inside the extracted bundle
+func (extractor ScriptExtractor) ScriptName() string {
+	return extractor.scriptName
+}
+
+func (extractor ScriptExtractor) ExtractTo(root *os.Root) ([]string, error) {
+	if err := newEntryLimiter(extractor.limits).check(extractor.scriptName, extractor.size); err != nil {
+		return nil, err
+	}
+
+	outFile, err := root.OpenFile(extractor.scriptName, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer outFile.Close()
+
+	if err := copyEntry(outFile, extractor.rd, extractor.scriptName, extractor.size); err != nil {
+		return nil, err
+	}
+
+	if err := outFile.Sync(); err != nil {
+		return nil, err
+	}
+
+	return []string{extractor.scriptName}, nil
+}
+
+// Returns true if the detected bundle format is a Python script. Text files are
+// treated as scripts if the uploaded file name ends in .py
+func isScriptBundle(mimeType string, fileName string) bool {
+	return mimeType == mimeTypePython || (mimeType == mimeTypeText && strings.HasSuffix(strings.ToLower(fileName), ".py"))
+}
@@ -2,12 +2,14 @@ package extract
 
 import (
 	"archive/tar"
-	"bytes"
 	"fmt"
 	"io"
 	"io/fs"
 	"os"
 	"path"
+	"slices"
+
+	"github.com/MythicAgents/forgescript/pkg/config"
 )
 
 type tarEntry struct {
@@ -23,66 +25,160 @@ func (e tarEntry) FileInfo() fs.FileInfo {
 }
 
 type tarExtractor struct {
-	buffer []byte
+	rd     io.Reader
+	limits config.BundleLimits
 }
 
-func NewTarExtractor(data []byte) tarExtractor {
-	return tarExtractor{buffer: data}
+func NewTarExtractor(rd io.Reader, limits config.BundleLimits) tarExtractor {
+	return tarExtractor{rd: rd, limits: limits}
 }
 
+// Returns the path inside the bundle which a symlink or hard link points to.
+// Links pointing outside of the bundle are rejected
+func tarLinkTarget(hdr *tar.Header, entryPath string) (string, error) {
+	if path.IsAbs(hdr.Linkname) {
+		return "", fmt.Errorf("link %s points to the absolute path %s", hdr.Name, hdr.Linkname)
+	}
 
-func (extractor tarExtractor) ListFilePaths() ([]string, error) {
-	rd := tar.NewReader(bytes.NewReader(extractor.buffer))
+	target := hdr.Linkname
+	if hdr.Typeflag == tar.TypeSymlink {
+		// Symlink targets are relative to the directory containing the link while
+		// hard link targets are relative to the archive root
+		target = path.Join(path.Dir(entryPath), hdr.Linkname)
+	}
 
-	filePaths := []string{}
-	for {
-		hdr, err := rd.Next()
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			return nil, err
-		}
+	cleaned, err := cleanEntryPath(target)
+	if err != nil {
+		return "", fmt.Errorf("link %s points outside of the bundle", hdr.Name)
+	}
+
+	return cleaned, nil
+}
 
-		filePaths = append(filePaths, hdr.Name)
+// Checks that the tar entry is a type which can be extracted
+func checkTarEntryType(hdr *tar.Header) error {
+	switch hdr.Typeflag {
+	case tar.TypeReg, tar.TypeRegA, tar.TypeDir, tar.TypeSymlink, tar.TypeLink, tar.TypeXGlobalHeader:
+		return nil
+	case tar.TypeChar, tar.TypeBlock:
+		return fmt.Errorf("tar entry %s is a device file", hdr.Name)
+	case tar.TypeFifo:
+		return fmt.Errorf("tar entry %s is a FIFO", hdr.Name)
 	}
 
-	return filePaths, nil
+	return fmt.Errorf("tar entry %s has unsupported type '%c'", hdr.Name, hdr.Typeflag)
 }
 
+func extractTarFile(root *os.Root, rd io.Reader, hdr *tar.Header, filePath string) error {
+	if err := mkdirParents(root, filePath); err != nil {
+		return err
+	}
+
+	outFile, err := root.OpenFile(filePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, fileModeOrDefault(hdr.FileInfo().Mode()))
+	if err != nil {
+		return err
+	}
+	defer outFile.Close()
 
-func (extractor tarExtractor) ExtractTo(root *os.Root) error {
-	rd := tar.NewReader(bytes.NewReader(extractor.buffer))
+	if err := copyEntry(outFile, rd, hdr.Name, hdr.Size); err != nil {
+		return err
+	}
+
+	return outFile.Sync()
+}
+
+// Returns the path and file info of the file a symlink or hard link points to. The
+// target must be a regular file which was already extracted from the bundle
+func resolveTarLink(root *os.Root, hdr *tar.Header, filePath string) (string, os.FileInfo, error) {
+	target, err := tarLinkTarget(hdr, filePath)
+	if err != nil {
+		return "", nil, err
+	}
+
+	targetInfo, err := root.Lstat(target)
+	if err != nil {
+		return "", nil, fmt.Errorf("link %s points to %s which is not in the bundle", hdr.Name, hdr.Linkname)
+	} else if !targetInfo.Mode().IsRegular() {
+		return "", nil, fmt.Errorf("link %s does not point to a regular file", hdr.Name)
+	}
+
+	return target, targetInfo, nil
+}
 
+// Extracts a symlink or hard link as a copy of the resolved target file
+func extractTarLink(root *os.Root, hdr *tar.Header, target string, targetInfo os.FileInfo, filePath string) error {
+	targetFile, err := root.Open(target)
+	if err != nil {
+		return err
+	}
+	defer targetFile.Close()
+
+	linkHdr := *hdr
+	linkHdr.Size = targetInfo.Size()
+	linkHdr.Mode = int64(targetInfo.Mode().Perm())
+
+	return extractTarFile(root, targetFile, &linkHdr, filePath)
+}
+
+func (extractor tarExtractor) ExtractTo(root *os.Root) ([]string, error) {
+	rd := tar.NewReader(extractor.rd)
+	limiter := newEntryLimiter(extractor.limits)
+
+	filePaths := []string{}
 	for {
 		hdr, err := rd.Next()
 		if err == io.EOF {
 			break
 		} else if err != nil {
-			return err
+			return nil, err
 		}
 
-		pathDir := path.Dir(hdr.Name)
-		if pathDir != "." {
-			if _, err := root.Stat(pathDir); err != nil {
-				if err := root.Mkdir(pathDir, 0700); err != nil {
-					return err
-				}
-			}
+		if err := checkTarEntryType(hdr); err != nil {
+			return nil, err
 		}
 
-		outFile, err := root.OpenFile(hdr.Name, os.O_CREATE | os.O_RDWR, hdr.FileInfo().Mode())
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+
+		filePath, err := cleanEntryPath(hdr.Name)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		if w, err := io.Copy(outFile, rd); err != nil {
-			return err
-		} else if w != hdr.Size {
-			return fmt.Errorf("file write for %s truncated", hdr.Name)
+		// Links are extracted as copies of their target so they count with its size
+		size := hdr.Size
+		linkTarget, linkTargetInfo := "", os.FileInfo(nil)
+		if hdr.Typeflag == tar.TypeSymlink || hdr.Typeflag == tar.TypeLink {
+			linkTarget, linkTargetInfo, err = resolveTarLink(root, hdr, filePath)
+			if err != nil {
+				return nil, err
+			}
+
+			size = linkTargetInfo.Size()
+		}
+
+		if err := limiter.check(hdr.Name, size); err != nil {
+			return nil, err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = mkdirAll(root, filePath)
+		case tar.TypeSymlink, tar.TypeLink:
+			err = extractTarLink(root, hdr, linkTarget, linkTargetInfo, filePath)
+		default:
+			err = extractTarFile(root, rd, hdr, filePath)
 		}
 
-		outFile.Sync()
+		if err != nil {
+			return nil, err
+		}
+
+		if hdr.Typeflag != tar.TypeDir && !slices.Contains(filePaths, filePath) {
+			filePaths = append(filePaths, filePath)
+		}
 	}
 
-	return nil
+	return filePaths, nil
 }
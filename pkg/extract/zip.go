@@ -2,39 +2,121 @@ package extract
 
 import (
 	"archive/zip"
-	"bytes"
-	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
 	"os"
+	"slices"
+
+	"github.com/MythicAgents/forgescript/pkg/config"
 )
 
 type zipExtractor struct {
-	buffer []byte
+	rd     *zip.Reader
+	limits config.BundleLimits
+}
+
+func NewZipExtractor(bundle io.ReaderAt, size int64, limits config.BundleLimits) (zipExtractor, error) {
+	rd, err := zip.NewReader(bundle, size)
+	if err != nil {
+		return zipExtractor{}, err
+	}
+
+	return zipExtractor{rd: rd, limits: limits}, nil
 }
 
-func NewZipExtractor(data []byte) zipExtractor {
-	return zipExtractor{buffer: data}
+// Checks every entry in the zip file against the bundle limits. The sizes are taken
+// from the central directory and enforced again while extracting
+func (extractor zipExtractor) checkLimits() error {
+	limiter := newEntryLimiter(extractor.limits)
+	for _, file := range extractor.rd.File {
+		if file.UncompressedSize64 > math.MaxInt64 {
+			return fmt.Errorf("%w: file %s is too large", ErrLimitExceeded, file.Name)
+		}
+
+		if err := limiter.check(file.Name, int64(file.UncompressedSize64)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Checks the zip archive against the bundle limits and returns it as a file system
+// without extracting it. Entries which could not be extracted are rejected
+func (extractor zipExtractor) Open() (fs.FS, error) {
+	if err := extractor.checkLimits(); err != nil {
+		return nil, err
+	}
+
+	for _, file := range extractor.rd.File {
+		if _, err := cleanEntryPath(file.Name); err != nil {
+			return nil, err
+		}
+
+		if !file.FileInfo().IsDir() && !file.Mode().IsRegular() {
+			return nil, fmt.Errorf("zip entry %s is not a regular file", file.Name)
+		}
+	}
+
+	return extractor.rd, nil
 }
 
-func (extractor zipExtractor) ListFilePaths() ([]string, error) {
-	byteRd := bytes.NewReader(extractor.buffer)
+func extractZipFile(root *os.Root, file *zip.File, filePath string) error {
+	if err := mkdirParents(root, filePath); err != nil {
+		return err
+	}
+
+	rd, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
 
-	rd, err := zip.NewReader(byteRd, byteRd.Size())
+	outFile, err := root.OpenFile(filePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, fileModeOrDefault(file.Mode()))
 	if err != nil {
-		return []string{}, err
+		return err
+	}
+	defer outFile.Close()
+
+	if err := copyEntry(outFile, rd, file.Name, int64(file.UncompressedSize64)); err != nil {
+		return err
+	}
+
+	return outFile.Sync()
+}
+
+func (extractor zipExtractor) ExtractTo(root *os.Root) ([]string, error) {
+	if err := extractor.checkLimits(); err != nil {
+		return nil, err
 	}
 
 	filePaths := []string{}
-	for _, file := range rd.File {
+	for _, file := range extractor.rd.File {
+		filePath, err := cleanEntryPath(file.Name)
+		if err != nil {
+			return nil, err
+		}
+
 		if file.FileInfo().IsDir() {
+			if err := mkdirAll(root, filePath); err != nil {
+				return nil, err
+			}
+
 			continue
+		} else if !file.Mode().IsRegular() {
+			return nil, fmt.Errorf("zip entry %s is not a regular file", file.Name)
 		}
 
-		filePaths = append(filePaths, file.Name)
+		if err := extractZipFile(root, file, filePath); err != nil {
+			return nil, err
+		}
+
+		if !slices.Contains(filePaths, filePath) {
+			filePaths = append(filePaths, filePath)
+		}
 	}
 
 	return filePaths, nil
 }
-
-func (extractor zipExtractor) ExtractTo(root *os.Root) error {
-	return errors.New("zip ExtractTo unimplemented")
-}
@@ -0,0 +1,227 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+const (
+	JSONFile = "forgescript.json"
+	TOMLFile = "forgescript.toml"
+)
+
+// Versions in the form of MAJOR.MINOR.PATCH with an optional 'v' prefix, pre-release
+// and build metadata
+var versionPattern = regexp.MustCompile(`^v?(\d+)(?:\.(\d+))?(?:\.(\d+))?(?:-([0-9A-Za-z.-]+))?(?:\+[0-9A-Za-z.-]+)?$`)
+
+// Metadata describing a bundle which is read from the bundle root
+type Manifest struct {
+	// Name of the bundle
+	Name string `json:"name" toml:"name"`
+
+	// Version of the bundle
+	Version string `json:"version" toml:"version"`
+
+	Description string `json:"description,omitempty" toml:"description"`
+	Author      string `json:"author,omitempty" toml:"author"`
+
+	// Scripts run in order when the bundle is loaded
+	EntryScripts []string `json:"entry_scripts" toml:"entry_scripts"`
+
+	// Minimum forgescript version required for loading the bundle
+	MinForgescriptVersion string `json:"min_forgescript_version,omitempty" toml:"min_forgescript_version"`
+
+	// Operating systems supported by the aliases in the bundle. Empty for any
+	SupportedOS []string `json:"supported_os,omitempty" toml:"supported_os"`
+
+	// Callback architectures supported by the aliases in the bundle. Empty for any
+	Architectures []string `json:"architectures,omitempty" toml:"architectures"`
+
+	// How long the entry scripts may run when the bundle is loaded. Empty for the
+	// timeout configured for the container
+	LoadTimeout Duration `json:"load_timeout,omitempty" toml:"load_timeout"`
+
+	// How long an alias callback may run when an alias is invoked. Empty for the
+	// timeout configured for the container
+	InvokeTimeout Duration `json:"invoke_timeout,omitempty" toml:"invoke_timeout"`
+}
+
+// Duration written as a string such as "90s" or "2m"
+type Duration time.Duration
+
+func (duration *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+
+	*duration = Duration(parsed)
+	return nil
+}
+
+func (duration Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(duration).String()), nil
+}
+
+// Parses and validates a manifest. The file name selects JSON or TOML
+func Parse(fileName string, data []byte) (*Manifest, error) {
+	manifest := &Manifest{}
+
+	if fileName == TOMLFile {
+		decoder := toml.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(manifest); err != nil {
+			return nil, fmt.Errorf("could not parse %s %w", fileName, err)
+		}
+	} else {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(manifest); err != nil {
+			return nil, fmt.Errorf("could not parse %s %w", fileName, err)
+		}
+	}
+
+	if err := manifest.validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s %w", fileName, err)
+	}
+
+	return manifest, nil
+}
+
+// Reads the manifest from the bundle root.
+// Returns nil if the bundle does not contain a manifest
+func Load(bundle fs.FS) (*Manifest, error) {
+	found := []string{}
+	for _, fileName := range []string{JSONFile, TOMLFile} {
+		if _, err := fs.Stat(bundle, fileName); err == nil {
+			found = append(found, fileName)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	if len(found) == 0 {
+		return nil, nil
+	} else if len(found) > 1 {
+		return nil, fmt.Errorf("bundle contains both %s and %s", JSONFile, TOMLFile)
+	}
+
+	data, err := fs.ReadFile(bundle, found[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(found[0], data)
+}
+
+func (manifest *Manifest) validate() error {
+	if len(manifest.Name) == 0 {
+		return errors.New("missing bundle name")
+	}
+
+	if _, err := parseVersion(manifest.Version); err != nil {
+		return fmt.Errorf("invalid bundle version %w", err)
+	}
+
+	if len(manifest.MinForgescriptVersion) > 0 {
+		if _, err := parseVersion(manifest.MinForgescriptVersion); err != nil {
+			return fmt.Errorf("invalid minimum forgescript version %w", err)
+		}
+	}
+
+	if len(manifest.EntryScripts) == 0 {
+		return errors.New("no entry scripts")
+	}
+
+	if manifest.LoadTimeout < 0 {
+		return errors.New("load timeout is negative")
+	} else if manifest.InvokeTimeout < 0 {
+		return errors.New("invoke timeout is negative")
+	}
+
+	for i, script := range manifest.EntryScripts {
+		cleaned := path.Clean(script)
+		if len(script) == 0 || path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+			return fmt.Errorf("entry script '%s' is not a path inside the bundle", script)
+		}
+
+		manifest.EntryScripts[i] = cleaned
+	}
+
+	return nil
+}
+
+// Checks that the current forgescript version satisfies the minimum version required
+// by the bundle. Development builds without a version are always allowed
+func (manifest *Manifest) CheckVersion(current string) error {
+	if len(manifest.MinForgescriptVersion) == 0 {
+		return nil
+	}
+
+	currentVersion, err := parseVersion(current)
+	if err != nil {
+		return nil
+	}
+
+	minVersion, _ := parseVersion(manifest.MinForgescriptVersion)
+	if compareVersions(currentVersion, minVersion) < 0 {
+		return fmt.Errorf("bundle %s requires forgescript %s or newer (running %s)", manifest.Name, manifest.MinForgescriptVersion, current)
+	}
+
+	return nil
+}
+
+type version struct {
+	parts      [3]int
+	prerelease string
+}
+
+func parseVersion(val string) (version, error) {
+	match := versionPattern.FindStringSubmatch(val)
+	if match == nil {
+		return version{}, fmt.Errorf("'%s' is not a version number", val)
+	}
+
+	parsed := version{prerelease: match[4]}
+	for i, part := range match[1:4] {
+		if len(part) == 0 {
+			continue
+		}
+
+		num, err := strconv.Atoi(part)
+		if err != nil {
+			return version{}, fmt.Errorf("'%s' is not a version number", val)
+		}
+
+		parsed.parts[i] = num
+	}
+
+	return parsed, nil
+}
+
+// Returns a negative number if a is older than b, a positive number if a is newer than
+// b and 0 if they are the same version
+func compareVersions(a version, b version) int {
+	for i := range a.parts {
+		if a.parts[i] != b.parts[i] {
+			return a.parts[i] - b.parts[i]
+		}
+	}
+
+	// A pre-release is older than the release of the same version
+	if len(a.prerelease) == 0 || len(b.prerelease) == 0 {
+		return len(b.prerelease) - len(a.prerelease)
+	}
+
+	return strings.Compare(a.prerelease, b.prerelease)
+}
@@ -0,0 +1,117 @@
+package manifest
+
+import (
+	"encoding/json"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseJSON(t *testing.T) {
+	manifest, err := Parse(JSONFile, []byte(`{
+		"name": "sa-whoami",
+		"version": "1.2.0",
+		"entry_scripts": ["./forgescript_alias.py", "extra/aliases.py"],
+		"min_forgescript_version": "v0.0.2",
+		"supported_os": ["Windows"],
+		"architectures": ["x64"]
+	}`))
+	assert.Nil(t, err, "Parse() returned an error")
+	assert.Equal(t, "sa-whoami", manifest.Name)
+	assert.Equal(t, []string{"forgescript_alias.py", "extra/aliases.py"}, manifest.EntryScripts)
+	assert.Equal(t, []string{"Windows"}, manifest.SupportedOS)
+	assert.Equal(t, []string{"x64"}, manifest.Architectures)
+}
+
+func TestParseTOML(t *testing.T) {
+	manifest, err := Parse(TOMLFile, []byte(`
+name = "sa-whoami"
+version = "1.2.0"
+author = "@M_alphaaa"
+entry_scripts = ["forgescript_alias.py"]
+`))
+	assert.Nil(t, err, "Parse() returned an error")
+	assert.Equal(t, "sa-whoami", manifest.Name)
+	assert.Equal(t, "@M_alphaaa", manifest.Author)
+	assert.Equal(t, []string{"forgescript_alias.py"}, manifest.EntryScripts)
+}
+
+func TestParseTimeouts(t *testing.T) {
+	manifest, err := Parse(TOMLFile, []byte(`
+name = "sa-whoami"
+version = "1.2.0"
+entry_scripts = ["forgescript_alias.py"]
+load_timeout = "2m"
+invoke_timeout = "45s"
+`))
+	assert.Nil(t, err, "Parse() returned an error")
+	assert.Equal(t, Duration(2*time.Minute), manifest.LoadTimeout)
+	assert.Equal(t, Duration(45*time.Second), manifest.InvokeTimeout)
+
+	manifest, err = Parse(JSONFile, []byte(`{"name": "a", "version": "1.0.0", "entry_scripts": ["a.py"], "invoke_timeout": "1m30s"}`))
+	assert.Nil(t, err, "Parse() returned an error")
+	assert.Equal(t, Duration(0), manifest.LoadTimeout)
+	assert.Equal(t, Duration(90*time.Second), manifest.InvokeTimeout)
+
+	serialized, err := json.Marshal(manifest)
+	assert.Nil(t, err, "json.Marshal() returned an error")
+	assert.Contains(t, string(serialized), `"invoke_timeout":"1m30s"`)
+	assert.NotContains(t, string(serialized), "load_timeout")
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := map[string]string{
+		"missing name":        `{"version": "1.0.0", "entry_scripts": ["a.py"]}`,
+		"invalid version":     `{"name": "a", "version": "latest", "entry_scripts": ["a.py"]}`,
+		"no entry scripts":    `{"name": "a", "version": "1.0.0", "entry_scripts": []}`,
+		"script outside":      `{"name": "a", "version": "1.0.0", "entry_scripts": ["../a.py"]}`,
+		"absolute script":     `{"name": "a", "version": "1.0.0", "entry_scripts": ["/a.py"]}`,
+		"invalid min version": `{"name": "a", "version": "1.0.0", "entry_scripts": ["a.py"], "min_forgescript_version": "x"}`,
+		"unknown field":       `{"name": "a", "version": "1.0.0", "entry_scripts": ["a.py"], "entry_script": "a.py"}`,
+		"invalid timeout":     `{"name": "a", "version": "1.0.0", "entry_scripts": ["a.py"], "load_timeout": "soon"}`,
+		"negative timeout":    `{"name": "a", "version": "1.0.0", "entry_scripts": ["a.py"], "invoke_timeout": "-5s"}`,
+	}
+
+	for name, data := range tests {
+		_, err := Parse(JSONFile, []byte(data))
+		assert.NotNil(t, err, "Parse() accepted a manifest with %s", name)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	manifest, err := Load(fstest.MapFS{"forgescript_alias.py": {}})
+	assert.Nil(t, err, "Load() returned an error for a bundle without a manifest")
+	assert.Nil(t, manifest, "Load() returned a manifest for a bundle without one")
+
+	_, err = Load(fstest.MapFS{
+		JSONFile: {Data: []byte(`{"name": "a", "version": "1.0.0", "entry_scripts": ["a.py"]}`)},
+		TOMLFile: {Data: []byte("name = \"a\"\nversion = \"1.0.0\"\nentry_scripts = [\"a.py\"]\n")},
+	})
+	assert.NotNil(t, err, "Load() accepted a bundle with two manifests")
+}
+
+func TestCheckVersion(t *testing.T) {
+	manifest := &Manifest{Name: "a", MinForgescriptVersion: "0.1.0"}
+
+	tests := map[string]bool{
+		"v0.1.0":                             true,
+		"v0.2.3":                             true,
+		"v1.0.0":                             true,
+		"v0.0.2":                             false,
+		"v0.1.0-rc.1":                        false,
+		"v0.1.1-0.20250814000000-abcdef0123": true,
+		"(devel)":                            true,
+		"":                                   true,
+	}
+
+	for current, allowed := range tests {
+		err := manifest.CheckVersion(current)
+		if allowed {
+			assert.Nil(t, err, "CheckVersion() rejected %s", current)
+		} else {
+			assert.NotNil(t, err, "CheckVersion() accepted %s", current)
+		}
+	}
+}
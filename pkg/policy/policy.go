@@ -0,0 +1,217 @@
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// Actions checked against the policies
+const (
+	ActionLoad    = "load"
+	ActionUnload  = "unload"
+	ActionApprove = "approve"
+	ActionInvoke  = "invoke"
+)
+
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// Name reported when no policy matches a request and the default effect denies it
+const DefaultPolicyName = "default"
+
+var validActions = []string{ActionLoad, ActionUnload, ActionApprove, ActionInvoke}
+
+// Rule allowing or denying actions for a set of operators and operations
+type Policy struct {
+	// Name reported when the policy denies a request
+	Name string `json:"name" toml:"name"`
+
+	// Either allow or deny
+	Effect string `json:"effect" toml:"effect"`
+
+	// Mythic operator usernames the policy applies to. Empty for any
+	Operators []string `json:"operators,omitempty" toml:"operators"`
+
+	// Mythic operation names the policy applies to. Empty for any
+	Operations []string `json:"operations,omitempty" toml:"operations"`
+
+	// Actions the policy applies to
+	Actions []string `json:"actions" toml:"actions"`
+
+	// Glob patterns of the alias names the policy applies to when invoking aliases.
+	// Empty for any
+	Aliases []string `json:"aliases,omitempty" toml:"aliases"`
+}
+
+// Ordered list of policies. The first policy matching a request decides whether it
+// is allowed
+type Policies struct {
+	// Effect for requests which do not match any policy. Defaults to allow
+	Default string `json:"default,omitempty" toml:"default"`
+
+	Policies []Policy `json:"policy" toml:"policy"`
+}
+
+// Action requested by an operator
+type Request struct {
+	Operator  string
+	Operation string
+	Action    string
+
+	// Name of the alias being invoked
+	Alias string
+}
+
+// Returned when a request is denied
+type DeniedError struct {
+	Policy  string
+	Request Request
+}
+
+func (e *DeniedError) Error() string {
+	action := fmt.Sprintf("%s bundles", e.Request.Action)
+	if e.Request.Action == ActionInvoke {
+		action = fmt.Sprintf("invoke alias '%s'", e.Request.Alias)
+	}
+
+	return fmt.Sprintf("operator '%s' in operation '%s' may not %s (denied by policy '%s')", e.Request.Operator, e.Request.Operation, action, e.Policy)
+}
+
+// Parses and validates a list of policies. Files ending in .toml are parsed as TOML
+// and anything else as JSON
+func Parse(fileName string, data []byte) (*Policies, error) {
+	policies := &Policies{}
+
+	if strings.EqualFold(filepath.Ext(fileName), ".toml") {
+		decoder := toml.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(policies); err != nil {
+			return nil, fmt.Errorf("could not parse %s %w", fileName, err)
+		}
+	} else {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(policies); err != nil {
+			return nil, fmt.Errorf("could not parse %s %w", fileName, err)
+		}
+	}
+
+	if err := policies.validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s %w", fileName, err)
+	}
+
+	return policies, nil
+}
+
+// Reads the policies from a file
+func Load(policyPath string) (*Policies, error) {
+	data, err := os.ReadFile(policyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(filepath.Base(policyPath), data)
+}
+
+func (policies *Policies) validate() error {
+	if len(policies.Default) == 0 {
+		policies.Default = EffectAllow
+	} else if policies.Default != EffectAllow && policies.Default != EffectDeny {
+		return fmt.Errorf("default effect '%s' is not %s or %s", policies.Default, EffectAllow, EffectDeny)
+	}
+
+	names := map[string]bool{}
+	for _, policy := range policies.Policies {
+		if len(policy.Name) == 0 {
+			return errors.New("policy without a name")
+		} else if policy.Name == DefaultPolicyName {
+			return fmt.Errorf("policy name '%s' is reserved", DefaultPolicyName)
+		} else if names[policy.Name] {
+			return fmt.Errorf("duplicate policy '%s'", policy.Name)
+		}
+
+		names[policy.Name] = true
+
+		if policy.Effect != EffectAllow && policy.Effect != EffectDeny {
+			return fmt.Errorf("policy '%s' effect '%s' is not %s or %s", policy.Name, policy.Effect, EffectAllow, EffectDeny)
+		}
+
+		if len(policy.Actions) == 0 {
+			return fmt.Errorf("policy '%s' has no actions", policy.Name)
+		}
+
+		for _, action := range policy.Actions {
+			if !slices.Contains(validActions, action) {
+				return fmt.Errorf("policy '%s' action '%s' is not one of %s", policy.Name, action, strings.Join(validActions, ", "))
+			}
+		}
+
+		if len(policy.Aliases) > 0 && !slices.Equal(policy.Actions, []string{ActionInvoke}) {
+			return fmt.Errorf("policy '%s' lists aliases but applies to actions other than %s", policy.Name, ActionInvoke)
+		}
+
+		for _, pattern := range policy.Aliases {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("policy '%s' alias pattern '%s' is invalid %w", policy.Name, pattern, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (policy *Policy) matches(request Request) bool {
+	if len(policy.Operators) > 0 && !slices.Contains(policy.Operators, request.Operator) {
+		return false
+	}
+
+	if len(policy.Operations) > 0 && !slices.Contains(policy.Operations, request.Operation) {
+		return false
+	}
+
+	if !slices.Contains(policy.Actions, request.Action) {
+		return false
+	}
+
+	if len(policy.Aliases) > 0 {
+		return slices.ContainsFunc(policy.Aliases, func(pattern string) bool {
+			matched, _ := path.Match(pattern, request.Alias)
+			return matched
+		})
+	}
+
+	return true
+}
+
+// Returns a *DeniedError naming the policy which denied the request, or nil if the
+// request is allowed
+func (policies *Policies) Check(request Request) error {
+	for _, policy := range policies.Policies {
+		if !policy.matches(request) {
+			continue
+		}
+
+		if policy.Effect == EffectDeny {
+			return &DeniedError{Policy: policy.Name, Request: request}
+		}
+
+		return nil
+	}
+
+	if policies.Default == EffectDeny {
+		return &DeniedError{Policy: DefaultPolicyName, Request: request}
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testPolicies = `
+default = "deny"
+
+[[policy]]
+name = "no-credential-aliases"
+effect = "deny"
+operations = ["Chimera"]
+actions = ["invoke"]
+aliases = ["dump_*"]
+
+[[policy]]
+name = "leads-manage-bundles"
+effect = "allow"
+operators = ["alice"]
+actions = ["load", "unload", "approve"]
+
+[[policy]]
+name = "chimera-aliases"
+effect = "allow"
+operations = ["Chimera"]
+actions = ["invoke"]
+`
+
+func TestParseTOML(t *testing.T) {
+	policies, err := Parse("policy.toml", []byte(testPolicies))
+	assert.Nil(t, err, "Parse() returned an error")
+	assert.Equal(t, EffectDeny, policies.Default)
+	assert.Len(t, policies.Policies, 3)
+	assert.Equal(t, []string{"dump_*"}, policies.Policies[0].Aliases)
+}
+
+func TestParseJSON(t *testing.T) {
+	policies, err := Parse("policy.json", []byte(`{
+		"policy": [{"name": "leads", "effect": "allow", "operators": ["alice"], "actions": ["load"]}]
+	}`))
+	assert.Nil(t, err, "Parse() returned an error")
+	assert.Equal(t, EffectAllow, policies.Default)
+	assert.Equal(t, []string{"alice"}, policies.Policies[0].Operators)
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := map[string]string{
+		"invalid default":  `{"default": "maybe"}`,
+		"missing name":     `{"policy": [{"effect": "allow", "actions": ["load"]}]}`,
+		"reserved name":    `{"policy": [{"name": "default", "effect": "allow", "actions": ["load"]}]}`,
+		"duplicate name":   `{"policy": [{"name": "a", "effect": "allow", "actions": ["load"]}, {"name": "a", "effect": "deny", "actions": ["load"]}]}`,
+		"invalid effect":   `{"policy": [{"name": "a", "effect": "permit", "actions": ["load"]}]}`,
+		"no actions":       `{"policy": [{"name": "a", "effect": "allow"}]}`,
+		"unknown action":   `{"policy": [{"name": "a", "effect": "allow", "actions": ["delete"]}]}`,
+		"aliases for load": `{"policy": [{"name": "a", "effect": "allow", "actions": ["load"], "aliases": ["x"]}]}`,
+		"invalid pattern":  `{"policy": [{"name": "a", "effect": "allow", "actions": ["invoke"], "aliases": ["["]}]}`,
+		"unknown field":    `{"policy": [{"name": "a", "effect": "allow", "actions": ["load"], "operator": "alice"}]}`,
+	}
+
+	for name, data := range tests {
+		_, err := Parse("policy.json", []byte(data))
+		assert.NotNil(t, err, "Parse() accepted policies with %s", name)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	policies, err := Parse("policy.toml", []byte(testPolicies))
+	assert.Nil(t, err, "Parse() returned an error")
+
+	tests := []struct {
+		request Request
+		policy  string
+	}{
+		{Request{Operator: "alice", Operation: "Chimera", Action: ActionLoad}, ""},
+		{Request{Operator: "bob", Operation: "Chimera", Action: ActionLoad}, DefaultPolicyName},
+		{Request{Operator: "bob", Operation: "Chimera", Action: ActionInvoke, Alias: "whoami"}, ""},
+		{Request{Operator: "alice", Operation: "Chimera", Action: ActionInvoke, Alias: "dump_lsass"}, "no-credential-aliases"},
+		{Request{Operator: "alice", Operation: "Hydra", Action: ActionInvoke, Alias: "dump_lsass"}, DefaultPolicyName},
+	}
+
+	for _, test := range tests {
+		err := policies.Check(test.request)
+		if len(test.policy) == 0 {
+			assert.Nil(t, err, "Check() denied %+v", test.request)
+			continue
+		}
+
+		var denied *DeniedError
+		assert.True(t, errors.As(err, &denied), "Check() allowed %+v", test.request)
+		assert.Equal(t, test.policy, denied.Policy)
+	}
+}
+
+func TestDeniedError(t *testing.T) {
+	err := &DeniedError{Policy: "no-credential-aliases", Request: Request{Operator: "bob", Operation: "Chimera", Action: ActionInvoke, Alias: "dump_lsass"}}
+	assert.Equal(t, "operator 'bob' in operation 'Chimera' may not invoke alias 'dump_lsass' (denied by policy 'no-credential-aliases')", err.Error())
+
+	err = &DeniedError{Policy: DefaultPolicyName, Request: Request{Operator: "bob", Operation: "Chimera", Action: ActionLoad}}
+	assert.Equal(t, "operator 'bob' in operation 'Chimera' may not load bundles (denied by policy 'default')", err.Error())
+}
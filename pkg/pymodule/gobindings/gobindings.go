@@ -67,6 +67,12 @@ func ForgescriptPyModuleCreateCommandCGo(scriptPath string, callbackID int, task
 
 //export ForgescriptPyModuleRegisterFileCGo
 func ForgescriptPyModuleRegisterFileCGo(taskID int, contents []byte, fileName string, deleteAfterFetch bool) (C.CGoReturnedString, C.CGoReturnedError) {
+	// Bundles from the container filesystem are loaded under negative task IDs which
+	// Mythic never uses, so there is no task to register the file for
+	if taskID < 0 {
+		return NewCGOEmptyString(), NewCGOReturnedError(errors.New("files cannot be registered while loading a bundle from the container filesystem. Register them inside the alias callback instead"))
+	}
+
 	rpcResult, err := mythicrpc.SendMythicRPCFileCreate(mythicrpc.MythicRPCFileCreateMessage{
 		TaskID: taskID,
 		FileContents: contents,
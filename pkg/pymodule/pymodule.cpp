@@ -1,3 +1,4 @@
+#include <algorithm>
 #include <cassert>
 #include <cstdint>
 #include <filesystem>
@@ -46,8 +47,8 @@ namespace {
     assert(state);
 
     if (auto *run_alias = std::get_if<pymodule::RunAliasState>(&state->get())) {
-      if (!run_alias->callback && run_alias->alias_name == name) {
-        run_alias->callback = callback;
+      if (run_alias->loaded) {
+        run_alias->loaded->get().try_emplace(std::string{name}, callback);
       }
 
       return;
@@ -140,23 +141,39 @@ namespace {
 
     auto& registered_aliases = run_script_state.registered.get();
     registered_aliases.insert(std::string{name});
+    run_script_state.loaded.get().try_emplace(std::string{name}, callback);
   }
 
   std::string register_file(const std::filesystem::path& path) {
     std::filesystem::path full_path{};
 
+    py::dict gbls = py::globals();
     if (path.is_relative()) {
-      auto script_path = pybind11::globals()["__file__"].cast<std::filesystem::path>();
+      auto script_path = gbls["__file__"].cast<std::filesystem::path>();
       full_path = script_path.parent_path() / path;
     } else {
       full_path = path;
     }
 
-    auto file_size = std::filesystem::file_size(full_path);
-    std::vector<std::byte> file_data(file_size);
-    std::ifstream filestream{full_path, std::ios::binary};
-    filestream.read(reinterpret_cast<char *>(file_data.data()),
-                    static_cast<long>(file_size));
+    std::vector<std::byte> file_data{};
+
+    // Scripts run from a bundle archive read files through the loader of the archive
+    // instead of the filesystem
+    if (gbls.contains("__loader__") && py::hasattr(gbls["__loader__"], "get_data")) {
+      auto data = gbls["__loader__"]
+                    .attr("get_data")(full_path.lexically_normal().generic_string())
+                    .cast<std::string>();
+      file_data.resize(data.size());
+      std::ranges::transform(data, file_data.begin(), [](char c) {
+        return static_cast<std::byte>(c);
+      });
+    } else {
+      auto file_size = std::filesystem::file_size(full_path);
+      file_data.resize(file_size);
+      std::ifstream filestream{full_path, std::ios::binary};
+      filestream.read(reinterpret_cast<char *>(file_data.data()),
+                      static_cast<long>(file_size));
+    }
 
     auto state = pymodule::get_shared_state();
     auto task_id = 0L;
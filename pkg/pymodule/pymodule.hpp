@@ -1,10 +1,12 @@
 #pragma once
 
 #include <functional>
+#include <map>
 #include <memory>
 #include <mutex>
 #include <optional>
 #include <set>
+#include <string>
 #include <string_view>
 #include <utility>
 #include <variant>
@@ -115,10 +117,14 @@ namespace forgescript::pymodule {
   using AliasCallback =
     pybind11::typing::Callable<AliasCallbackReturn(AliasCallbackParam)>;
 
+  using AliasCallbacks = std::map<std::string, AliasCallback>;
+
   struct [[gnu::visibility("hidden")]] RunAliasState {
-    std::string_view alias_name;
     long long task_id;
-    std::optional<AliasCallback> callback;
+
+    // Every callback registered by the script is kept here while the script is loaded
+    // for later alias invocations
+    std::optional<std::reference_wrapper<AliasCallbacks>> loaded;
   };
 
   struct [[gnu::visibility("hidden")]] RunScriptState {
@@ -126,6 +132,9 @@ namespace forgescript::pymodule {
     long long callback_id;
     long long task_id;
     std::reference_wrapper<std::set<std::string>> registered;
+
+    // Callbacks of the registered aliases, kept for later alias invocations
+    std::reference_wrapper<AliasCallbacks> loaded;
   };
 
   using SharedState = std::variant<std::monostate, RunAliasState, RunScriptState>;
@@ -1,6 +1,8 @@
 #include "bindings.hpp"
 
 #include <algorithm>
+#include <atomic>
+#include <functional>
 #include <iterator>
 #include <sstream>
 #include <string>
@@ -19,6 +21,208 @@
 
 namespace py = pybind11;
 
+namespace {
+
+  // Python helpers for running scripts from a zip archive held in memory. The loader
+  // is inserted into sys.meta_path so modules are imported from the archive and is set
+  // as the __loader__ of the script so `forgescript.register_file` can read files with
+  // get_data
+  constexpr const char *archive_runner_source = R"py(
+import builtins
+import importlib.abc
+import importlib.util
+import io
+import posixpath
+import sys
+import zipfile
+
+
+class ArchiveLoader(importlib.abc.MetaPathFinder, importlib.abc.Loader):
+    def __init__(self, archive, archive_name):
+        self.archive = zipfile.ZipFile(io.BytesIO(archive))
+        self.archive_name = archive_name
+        self.names = set(self.archive.namelist())
+
+    def member(self, path):
+        prefix = self.archive_name + "/"
+        if not path.startswith(prefix):
+            raise OSError(f"{path} is not inside of the bundle archive")
+
+        name = posixpath.normpath(path[len(prefix):])
+        if name == ".." or name.startswith("../") or name.startswith("/"):
+            raise OSError(f"{path} is not inside of the bundle archive")
+
+        return name
+
+    def get_data(self, path):
+        try:
+            return self.archive.read(self.member(path))
+        except KeyError:
+            raise FileNotFoundError(path) from None
+
+    def find_spec(self, fullname, path=None, target=None):
+        relpath = fullname.replace(".", "/")
+        for name, is_package in ((relpath + "/__init__.py", True), (relpath + ".py", False)):
+            if name not in self.names:
+                continue
+
+            spec = importlib.util.spec_from_loader(
+                fullname, self, origin=f"{self.archive_name}/{name}", is_package=is_package
+            )
+            spec.has_location = True
+            if is_package:
+                spec.submodule_search_locations = [f"{self.archive_name}/{relpath}"]
+
+            return spec
+
+        return None
+
+    def create_module(self, spec):
+        return None
+
+    def exec_module(self, module):
+        origin = module.__spec__.origin
+        code = compile(self.get_data(origin), origin, "exec", dont_inherit=True)
+        exec(code, module.__dict__)
+
+
+def run_archive_script(archive, archive_name, script, run_name):
+    loader = ArchiveLoader(archive, archive_name)
+    sys.meta_path.insert(0, loader)
+
+    script_path = f"{archive_name}/{posixpath.normpath(script)}"
+    code = compile(loader.get_data(script_path), script_path, "exec", dont_inherit=True)
+    exec(code, {
+        "__name__": run_name,
+        "__file__": script_path,
+        "__loader__": loader,
+        "__package__": None,
+        "__spec__": None,
+        "__cached__": None,
+        "__builtins__": builtins,
+    })
+)py";
+
+  // Runs the script from the filesystem or from the zip archive if one is given.
+  // The run name defaults to the one used by runpy.run_path
+  void run_script_path(const std::string& scriptPath, const std::string& archive,
+                       const std::string& archiveName,
+                       const std::string& runName = "<run_path>") {
+    using namespace py::literals;
+
+    if (archive.empty()) {
+      // Modules imported by the script must not write bytecode caches into the
+      // extracted bundle, whose files are checked before every alias invocation
+      py::module_::import("sys").attr("dont_write_bytecode") = true;
+
+      auto runpy = py::module_::import("runpy");
+      runpy.attr("run_path")(scriptPath, "run_name"_a = runName);
+      return;
+    }
+
+    py::dict scope{};
+    py::exec(archive_runner_source, scope);
+    scope["run_archive_script"](py::bytes(archive), archiveName, scriptPath, runName);
+  }
+
+  // Records the identifier of the thread running in a subinterpreter while it is active
+  // so the script can be interrupted from another thread
+  class running_thread_scope {
+    std::atomic<unsigned long>& m_thread;
+
+  public:
+    explicit running_thread_scope(std::atomic<unsigned long>& thread): m_thread{thread} {
+      m_thread = PyThread_get_thread_ident();
+    }
+    running_thread_scope(const running_thread_scope&) = delete;
+    running_thread_scope(running_thread_scope&&) = delete;
+    running_thread_scope& operator=(const running_thread_scope&) = delete;
+    running_thread_scope& operator=(running_thread_scope&&) = delete;
+    ~running_thread_scope() { m_thread = 0; }
+  };
+
+  // Builds the task passed to alias callbacks from the serialized task
+  forgescript::pymodule::Task make_alias_task(const std::string& taskJson) {
+    namespace pymodule = forgescript::pymodule;
+
+    auto deserialized_task = nlohmann::json::parse(taskJson);
+    const auto& task_args = deserialized_task["args"];
+    const auto& callback = deserialized_task["callback"];
+
+    pymodule::Task task{};
+    task.callback = pymodule::Callback{
+      .last_checkin = callback["last_checkin"],
+      .user = callback["user"],
+      .host = callback["host"],
+      .pid = callback["pid"],
+      .ip = callback["ip"],
+      .ips = callback["ips"],
+      .external_ip = callback["external_ip"],
+      .process_name = callback["process_name"],
+      .description = callback["description"],
+      .operator_username = callback["operator_username"],
+      .active = callback["active"],
+      .integrity_level = callback["integrity_level"],
+      .locked = callback["locked"],
+      .operation_name = callback["operation_name"],
+      .os = callback["os"],
+      .architecture = callback["architecture"],
+      .domain = callback["domain"],
+      .extra_info = callback["extra_info"],
+      .sleep_info = callback["sleep_info"],
+    };
+
+    if (!task_args.empty()) {
+      for (const auto& [key, value]: task_args.items()) {
+        if (value.is_string()) {
+          task.args[py::str(key)] = value.template get<std::string>();
+        } else if (value.is_number_float()) {
+          task.args[py::str(key)] = value.template get<float>();
+        } else if (value.is_number()) {
+          task.args[py::str(key)] = value.template get<int>();
+        } else if (value.is_boolean()) {
+          task.args[py::str(key)] = value.template get<bool>();
+        } else if (value.is_array()) {
+          py::list dictlist{};
+          for (const auto& arrvalue: value.template get<std::vector<std::string>>()) {
+            dictlist.append(arrvalue);
+          }
+
+          task.args[py::str(key)] = dictlist;
+        }
+      }
+    }
+
+    task.command_line = deserialized_task["command_line"];
+
+    return task;
+  }
+
+  // Runs the alias callback and returns the serialized aliased command
+  std::string run_alias_callback(const forgescript::pymodule::AliasCallback& callback,
+                                 const forgescript::pymodule::Task& task) {
+    using namespace py::literals;
+    namespace pymodule = forgescript::pymodule;
+
+    auto resp = callback(task);
+    py::print("Alias function response", resp);
+
+    auto aliased = resp.cast<pymodule::AliasedCommand>();
+
+    py::dict aliased_dict{};
+    aliased_dict["name"] = aliased.name;
+    aliased_dict["args"] = aliased.args;
+    aliased_dict["command_line"] = aliased.display_params;
+
+    auto pyjson = py::module_::import("json");
+    auto pyserialized =
+      pyjson.attr("dumps")(aliased_dict, "separators"_a = std::make_tuple(',', ':'));
+
+    return pyserialized.cast<std::string>();
+  }
+
+} // namespace
+
 class [[gnu::visibility("hidden")]] MainInterpreter::Impl {
   py::scoped_interpreter m_maininterpreter;
   py::gil_scoped_release m_release;
@@ -35,29 +239,65 @@ public:
 class [[gnu::visibility("hidden")]] SubInterpreter::Impl {
   py::subinterpreter m_subinterpreter;
 
+  // Alias callbacks kept by RunScript or LoadAliasCallbacks
+  forgescript::pymodule::AliasCallbacks m_callbacks;
+
+  // Thread running a script in the subinterpreter or 0
+  std::atomic<unsigned long> m_running_thread{0};
+
+  // Exception raised by Interrupt. It derives from BaseException so that scripts
+  // catching Exception do not swallow it. A bare except or except BaseException still
+  // catches it, which is why the interrupt is repeated
+  py::object m_timeout_exception;
+
 public:
   Impl() {
-    py::gil_scoped_acquire gil{};
-    m_subinterpreter = py::subinterpreter::create();
+    {
+      py::gil_scoped_acquire gil{};
+      m_subinterpreter = py::subinterpreter::create();
+    }
+
+    py::subinterpreter_scoped_activate guard{m_subinterpreter};
+    m_timeout_exception = py::reinterpret_steal<py::object>(
+        PyErr_NewException("forgescript._ScriptTimeout", PyExc_BaseException, nullptr));
+    if (!m_timeout_exception) {
+      throw py::error_already_set();
+    }
   }
   Impl(const Impl&) = delete;
   Impl(Impl&&) = delete;
   Impl& operator=(const Impl&) = delete;
   Impl& operator=(Impl&&) = delete;
-  ~Impl() = default;
+  ~Impl() {
+    // The callbacks and the exception are objects of the subinterpreter and must be
+    // released inside of it before it is destroyed
+    py::subinterpreter_scoped_activate guard{m_subinterpreter};
+    m_callbacks.clear();
+    m_timeout_exception = py::object{};
+  }
 
   GoResult<std::vector<std::string>> RunScript(const std::string& scriptPath,
                                                long long callbackID, long long taskID,
-                                               const std::string& operatorName);
-  GoResult<std::string> RunAliasCallback(const std::string& scriptPath, long long taskID,
-                                         const std::string& aliasName,
-                                         const std::string& taskJson);
+                                               const std::string& operatorName,
+                                               const std::string& archive = {},
+                                               const std::string& archiveName = {});
+  GoResult<std::vector<std::string>> LoadAliasCallbacks(const std::string& scriptPath,
+                                                        long long taskID,
+                                                        const std::string& archive = {},
+                                                        const std::string& archiveName = {});
+  GoResult<std::string> RunLoadedAliasCallback(long long taskID,
+                                               const std::string& aliasName,
+                                               const std::string& taskJson);
+  bool Interrupt();
 };
 
 GoResult<std::vector<std::string>>
 SubInterpreter::Impl::RunScript(const std::string& scriptPath, long long callbackID,
-                                long long taskID, const std::string& operatorName) {
+                                long long taskID, const std::string& operatorName,
+                                const std::string& archive,
+                                const std::string& archiveName) {
   py::subinterpreter_scoped_activate guard{m_subinterpreter};
+  running_thread_scope running{m_running_thread};
 
   try {
     using namespace py::literals;
@@ -70,12 +310,12 @@ SubInterpreter::Impl::RunScript(const std::string& scriptPath, long long callbac
       .callback_id = callbackID,
       .task_id = taskID,
       .registered = registered,
+      .loaded = std::ref(m_callbacks),
     }};
 
     pymodule::set_shared_state(state);
 
-    auto runpy = py::module_::import("runpy");
-    runpy.attr("run_path")(scriptPath, "run_name"_a = "__main__");
+    run_script_path(scriptPath, archive, archiveName, "__main__");
 
     std::vector<std::string> result{};
     result.reserve(registered.size());
@@ -86,107 +326,78 @@ SubInterpreter::Impl::RunScript(const std::string& scriptPath, long long callbac
     return {result, {}};
   } catch (py::error_already_set& exc) {
     exc.discard_as_unraisable(__func__);
+    m_callbacks.clear();
     return {{}, exc.what()};
   } catch (std::exception& exc) {
+    m_callbacks.clear();
     return {{}, exc.what()};
   }
 
   return {};
 }
 
-GoResult<std::string>
-SubInterpreter::Impl::RunAliasCallback(const std::string& scriptPath, long long taskID,
-                                       const std::string& aliasName,
-                                       const std::string& taskJson) {
+GoResult<std::vector<std::string>>
+SubInterpreter::Impl::LoadAliasCallbacks(const std::string& scriptPath, long long taskID,
+                                         const std::string& archive,
+                                         const std::string& archiveName) {
   py::subinterpreter_scoped_activate guard{m_subinterpreter};
+  running_thread_scope running{m_running_thread};
 
   try {
-    using namespace py::literals;
     namespace pymodule = forgescript::pymodule;
 
-    auto deserialized_task = nlohmann::json::parse(taskJson);
-    const auto& task_args = deserialized_task["args"];
-    const auto& callback = deserialized_task["callback"];
-
-    pymodule::Task task{};
-    task.callback = pymodule::Callback{
-      .last_checkin = callback["last_checkin"],
-      .user = callback["user"],
-      .host = callback["host"],
-      .pid = callback["pid"],
-      .ip = callback["ip"],
-      .ips = callback["ips"],
-      .external_ip = callback["external_ip"],
-      .process_name = callback["process_name"],
-      .description = callback["description"],
-      .operator_username = callback["operator_username"],
-      .active = callback["active"],
-      .integrity_level = callback["integrity_level"],
-      .locked = callback["locked"],
-      .operation_name = callback["operation_name"],
-      .os = callback["os"],
-      .architecture = callback["architecture"],
-      .domain = callback["domain"],
-      .extra_info = callback["extra_info"],
-      .sleep_info = callback["sleep_info"],
-    };
-
-    if (!task_args.empty()) {
-      for (const auto& [key, value]: task_args.items()) {
-        if (value.is_string()) {
-          task.args[py::str(key)] = value.template get<std::string>();
-        } else if (value.is_number_float()) {
-          task.args[py::str(key)] = value.template get<float>();
-        } else if (value.is_number()) {
-          task.args[py::str(key)] = value.template get<int>();
-        } else if (value.is_boolean()) {
-          task.args[py::str(key)] = value.template get<bool>();
-        } else if (value.is_array()) {
-          py::list dictlist{};
-          for (const auto& arrvalue: value.template get<std::vector<std::string>>()) {
-            dictlist.append(arrvalue);
-          }
-
-          task.args[py::str(key)] = dictlist;
-        }
-      }
-    }
-
-    task.command_line = deserialized_task["command_line"];
-
     pymodule::SharedState state{pymodule::RunAliasState{
-      .alias_name = aliasName,
       .task_id = taskID,
-      .callback = {},
+      .loaded = std::ref(m_callbacks),
     }};
 
     pymodule::set_shared_state(state);
 
-    auto runpy = py::module_::import("runpy");
-
-    runpy.attr("run_path")(scriptPath);
+    run_script_path(scriptPath, archive, archiveName);
 
-    auto& runstate = std::get<pymodule::RunAliasState>(state);
-    if (runstate.callback) {
+    std::vector<std::string> result{};
+    result.reserve(m_callbacks.size());
+    std::ranges::transform(m_callbacks, std::back_inserter(result), [](const auto& v) {
+      return v.first;
+    });
 
-      auto resp = (*runstate.callback)(task);
-      py::print("Alias function response", resp);
+    return {result, {}};
+  } catch (py::error_already_set& exc) {
+    exc.discard_as_unraisable(__func__);
+    m_callbacks.clear();
+    return {{}, exc.what()};
+  } catch (std::exception& exc) {
+    m_callbacks.clear();
+    return {{}, exc.what()};
+  }
 
-      auto aliased = resp.cast<pymodule::AliasedCommand>();
+  return {};
+}
 
-      py::dict aliased_dict{};
-      aliased_dict["name"] = aliased.name;
-      aliased_dict["args"] = aliased.args;
-      aliased_dict["command_line"] = aliased.display_params;
+GoResult<std::string>
+SubInterpreter::Impl::RunLoadedAliasCallback(long long taskID, const std::string& aliasName,
+                                             const std::string& taskJson) {
+  py::subinterpreter_scoped_activate guard{m_subinterpreter};
+  running_thread_scope running{m_running_thread};
 
-      auto pyjson = py::module_::import("json");
-      auto pyserialized =
-        pyjson.attr("dumps")(aliased_dict, "separators"_a = std::make_tuple(',', ':'));
+  try {
+    namespace pymodule = forgescript::pymodule;
 
-      return {pyserialized.cast<std::string>(), {}};
+    auto callback = m_callbacks.find(aliasName);
+    if (callback == m_callbacks.end()) {
+      throw std::runtime_error("could not find script registered alias callback function");
     }
 
-    throw std::runtime_error("could not find script registered alias callback function");
+    auto task = make_alias_task(taskJson);
+
+    pymodule::SharedState state{pymodule::RunAliasState{
+      .task_id = taskID,
+      .loaded = {},
+    }};
+
+    pymodule::set_shared_state(state);
+
+    return {run_alias_callback(callback->second, task), {}};
   } catch (py::error_already_set& exc) {
     exc.discard_as_unraisable(__func__);
     return {{}, exc.what()};
@@ -197,6 +408,18 @@ SubInterpreter::Impl::RunAliasCallback(const std::string& scriptPath, long long
   return {};
 }
 
+bool SubInterpreter::Impl::Interrupt() {
+  auto thread = m_running_thread.load();
+  if (thread == 0) {
+    return false;
+  }
+
+  // Waits for the running script to release the GIL of the subinterpreter. The
+  // exception is raised the next time the thread runs Python code
+  py::subinterpreter_scoped_activate guard{m_subinterpreter};
+  return PyThreadState_SetAsyncExc(thread, m_timeout_exception.ptr()) > 0;
+}
+
 SubInterpreter::SubInterpreter(): pImpl(new Impl) {}
 SubInterpreter::~SubInterpreter() = default;
 GoResult<std::vector<std::string>>
@@ -205,13 +428,33 @@ SubInterpreter::RunScript(const std::string& scriptPath, long long callbackID,
   return pImpl->RunScript(scriptPath, callbackID, taskID, operatorName);
 }
 
-GoResult<std::string> SubInterpreter::RunAliasCallback(const std::string& scriptPath,
-                                                       long long taskID,
-                                                       const std::string& aliasName,
-                                                       const std::string& taskJson) {
-  return pImpl->RunAliasCallback(scriptPath, taskID, aliasName, taskJson);
+GoResult<std::vector<std::string>>
+SubInterpreter::RunArchiveScript(const std::string& archive, const std::string& archiveName,
+                                 const std::string& scriptPath, long long callbackID,
+                                 long long taskID, const std::string& operatorName) {
+  return pImpl->RunScript(scriptPath, callbackID, taskID, operatorName, archive, archiveName);
+}
+
+GoResult<std::vector<std::string>>
+SubInterpreter::LoadAliasCallbacks(const std::string& scriptPath, long long taskID) {
+  return pImpl->LoadAliasCallbacks(scriptPath, taskID);
+}
+
+GoResult<std::vector<std::string>>
+SubInterpreter::LoadArchiveAliasCallbacks(const std::string& archive,
+                                          const std::string& archiveName,
+                                          const std::string& scriptPath, long long taskID) {
+  return pImpl->LoadAliasCallbacks(scriptPath, taskID, archive, archiveName);
 }
 
+GoResult<std::string> SubInterpreter::RunLoadedAliasCallback(long long taskID,
+                                                             const std::string& aliasName,
+                                                             const std::string& taskJson) {
+  return pImpl->RunLoadedAliasCallback(taskID, aliasName, taskJson);
+}
+
+bool SubInterpreter::Interrupt() { return pImpl->Interrupt(); }
+
 MainInterpreter::MainInterpreter(): pImpl(new Impl) {}
 MainInterpreter::~MainInterpreter() = default;
 
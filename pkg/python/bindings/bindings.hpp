@@ -23,6 +23,9 @@ public:
    *     import runpy
    *     runpy.run_path(scriptPath, run_name="__main__")
    *
+   * The callbacks of the registered aliases are kept in the subinterpreter so they can
+   * be run with RunLoadedAliasCallback without running the script again.
+   *
    * @param scriptPath The script path to run.
    * @param callbackID The callback ID.
    * @param taskID The task ID.
@@ -33,15 +36,71 @@ public:
                                                const std::string& operatorName);
 
   /**
-   * Runs an alias callback function.
-   * @param scriptPath The script path with the callback function.
+   * Runs a script from a zip archive held in memory like RunScript.
+   * Modules are imported from the archive and `forgescript.register_file` reads files
+   * from the archive. The `__file__` of the script is `archiveName/scriptPath`.
+   *
+   * @param archive The contents of the zip archive.
+   * @param archiveName The name used as the path of the archive.
+   * @param scriptPath The path of the script inside the archive.
+   * @param callbackID The callback ID.
+   * @param taskID The task ID.
+   * @return GoResult<std::vector<std::string>> List of aliases registered
+   */
+  GoResult<std::vector<std::string>> RunArchiveScript(const std::string& archive,
+                                                      const std::string& archiveName,
+                                                      const std::string& scriptPath,
+                                                      long long callbackID, long long taskID,
+                                                      const std::string& operatorName);
+
+  /**
+   * Runs the script and keeps every alias callback it registers in the subinterpreter so
+   * they can be run with RunLoadedAliasCallback without running the script again.
+   * Files registered while running the script are registered for the task.
+   *
+   * @param scriptPath The script path to run.
+   * @param taskID The task ID.
+   * @return GoResult<std::vector<std::string>> Names of the loaded alias callbacks
+   */
+  GoResult<std::vector<std::string>> LoadAliasCallbacks(const std::string& scriptPath,
+                                                        long long taskID);
+
+  /**
+   * Runs a script from a zip archive held in memory and keeps every alias callback it
+   * registers in the subinterpreter.
+   * @param archive The contents of the zip archive.
+   * @param archiveName The name used as the path of the archive.
+   * @param scriptPath The path of the script inside the archive.
+   * @param taskID The task ID.
+   * @return GoResult<std::vector<std::string>> Names of the loaded alias callbacks
+   */
+  GoResult<std::vector<std::string>> LoadArchiveAliasCallbacks(const std::string& archive,
+                                                               const std::string& archiveName,
+                                                               const std::string& scriptPath,
+                                                               long long taskID);
+
+  /**
+   * Runs an alias callback kept by RunScript, RunArchiveScript, LoadAliasCallbacks or
+   * LoadArchiveAliasCallbacks.
+   * @param taskID The task ID.
    * @param aliasName The name of the callback function to run.
    * @param taskJson The serialized task JSON.
-   * @return GoResult<std::string> TODO
+   * @return GoResult<std::string> The serialized aliased command
+   */
+  GoResult<std::string> RunLoadedAliasCallback(long long taskID, const std::string& aliasName,
+                                               const std::string& taskJson);
+
+  /**
+   * Raises `forgescript._ScriptTimeout` in the script running in the subinterpreter.
+   * The exception derives from BaseException, so `except Exception:` does not catch it
+   * but a bare `except:` or `except BaseException:` does. Callers repeat the interrupt
+   * until the script returns or they give up on the subinterpreter.
+   * Can be called from any thread while another thread runs a script. Blocks until the
+   * running script releases the GIL. Scripts blocked in a call outside of Python only
+   * see the exception once the call returns.
+   * @return bool Whether a running script was interrupted
    */
-  GoResult<std::string> RunAliasCallback(const std::string& scriptPath, long long taskID,
-                                         const std::string& aliasName,
-                                         const std::string& taskJson);
+  bool Interrupt();
 
 private:
   class Impl;
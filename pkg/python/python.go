@@ -2,8 +2,12 @@ package python
 
 import (
 	"errors"
+	"fmt"
 	"os"
 	"runtime"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/MythicAgents/forgescript/pkg/python/bindings"
 	"github.com/MythicMeta/MythicContainer/logging"
@@ -11,6 +15,18 @@ import (
 
 var eventQueue = make(chan func())
 
+// Returned when a script or alias callback runs longer than its timeout
+var ErrTimeout = errors.New("python script timed out")
+
+// Interval at which a script which ran over its timeout is interrupted again until it
+// returns
+const interruptInterval = time.Second
+
+// Number of times a script which ran over its timeout is interrupted before its
+// subinterpreter is given up on. Scripts can catch the interrupt with a bare except so
+// a single interrupt is not enough
+const maxInterrupts = 10
+
 func StartExecutorLoop() {
 	runtime.LockOSThread()
 
@@ -34,69 +50,213 @@ func do[T any](f func() T) chan T {
 	return done
 }
 
-func withSubInterpreter[T any](f func(sub bindings.SubInterpreter) T) T {
-	subinterpreter := <-do(func() bindings.SubInterpreter {
+func newSubInterpreter() bindings.SubInterpreter {
+	return <-do(func() bindings.SubInterpreter {
 		subinterpreter := bindings.NewSubInterpreter()
 		logging.LogDebug("Creating new python subinterpreter", "thread_id", bindings.OSThreadId(), "pointer", subinterpreter.Swigcptr())
 		return subinterpreter
 	})
+}
 
-	runtime.LockOSThread()
-	result := f(subinterpreter)
-	runtime.UnlockOSThread()
-
+func deleteSubInterpreter(subinterpreter bindings.SubInterpreter) {
 	go do(func() interface{} {
 		logging.LogDebug("Deleting python subinterpreter", "thread_id", bindings.OSThreadId(), "pointer", subinterpreter.Swigcptr())
 		bindings.DeleteSubInterpreter(subinterpreter)
 		return nil
 	})
+}
+
+// Runs f with the subinterpreter on a locked OS thread. A timeout of 0 waits for f to
+// return.
+// If f runs longer than the timeout, ErrTimeout is returned right away and the script
+// running in the subinterpreter is interrupted until f returns. The abandon function is
+// then called with the result so the result and subinterpreter can be deleted. If the
+// script is still running after maxInterrupts interrupts, the subinterpreter and the
+// OS thread running it are leaked
+func runWithTimeout[T any](subinterpreter bindings.SubInterpreter, timeout time.Duration, f func(sub bindings.SubInterpreter) T, abandon func(T)) (T, error) {
+	done := make(chan T, 1)
+	go func() {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+
+		done <- f(subinterpreter)
+	}()
+
+	if timeout <= 0 {
+		return <-done, nil
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case result := <-done:
+		return result, nil
+	case <-timer.C:
+	}
+
+	logging.LogInfo("Interrupting python script which ran over its timeout", "timeout", timeout, "pointer", subinterpreter.Swigcptr())
 
-	return result
+	go func() {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+
+		ticker := time.NewTicker(interruptInterval)
+		defer ticker.Stop()
+
+		subinterpreter.Interrupt()
+		for interrupts := 1; ; interrupts++ {
+			select {
+			case result := <-done:
+				logging.LogInfo("Interrupted python script returned", "pointer", subinterpreter.Swigcptr())
+				abandon(result)
+				return
+			case <-ticker.C:
+			}
+
+			if interrupts >= maxInterrupts {
+				logging.LogError(ErrTimeout, "Python script did not return after being interrupted, leaking its subinterpreter", "interrupts", interrupts, "pointer", subinterpreter.Swigcptr())
+				return
+			}
+
+			subinterpreter.Interrupt()
+		}
+	}()
+
+	var zero T
+	return zero, fmt.Errorf("%w after %s", ErrTimeout, timeout)
 }
 
-// Runs the script at the specified path.
-// Returns a map with the commands registered and list of payload types that registered
-// the command
-func RunScript(scriptPath string, callbackID int, taskID int, operatorName string) ([]string, error) {
+// Runs the script at the specified path in a new subinterpreter. A timeout of 0
+// disables the deadline.
+// Returns the interpreter holding the callbacks of the aliases registered by the
+// script so they can be run without running the script again
+func RunScript(scriptPath string, callbackID int, taskID int, operatorName string, timeout time.Duration) (*ScriptInterpreter, error) {
 	if scriptStat, err := os.Stat(scriptPath); err != nil {
-		return []string{}, err
+		return nil, err
 	} else if scriptStat.IsDir() {
-		return []string{}, errors.New("script path is a directory")
+		return nil, errors.New("script path is a directory")
 	}
 
-	result := withSubInterpreter(func(subinterpreter bindings.SubInterpreter) bindings.GoVecStringResult {
+	return runScript(timeout, func(subinterpreter bindings.SubInterpreter) bindings.GoVecStringResult {
 		logging.LogDebug("Running python.RunScript", "thread_id", bindings.OSThreadId())
 		return subinterpreter.RunScript(scriptPath, int64(callbackID), int64(taskID), operatorName)
 	})
+}
+
+// Runs the script at the specified path inside of a zip archive without extracting it.
+// Modules and files registered by the script are read from the archive. The archive
+// name is used as the directory of the script in its __file__
+func RunArchiveScript(archive []byte, archiveName string, scriptPath string, callbackID int, taskID int, operatorName string, timeout time.Duration) (*ScriptInterpreter, error) {
+	return runScript(timeout, func(subinterpreter bindings.SubInterpreter) bindings.GoVecStringResult {
+		logging.LogDebug("Running python.RunArchiveScript", "thread_id", bindings.OSThreadId())
+		return subinterpreter.RunArchiveScript(string(archive), archiveName, scriptPath, int64(callbackID), int64(taskID), operatorName)
+	})
+}
+
+func runScript(timeout time.Duration, run func(bindings.SubInterpreter) bindings.GoVecStringResult) (*ScriptInterpreter, error) {
+	interpreter, err := loadScriptInterpreter(timeout, run)
+	if err != nil {
+		logging.LogError(err, "RunScript returned an error")
+		return nil, err
+	}
+
+	return interpreter, nil
+}
+
+// Subinterpreter kept alive between alias invocations which holds the alias callbacks
+// registered by a script. The script is only run once and later invocations call the
+// stored callbacks directly
+type ScriptInterpreter struct {
+	mutex          sync.Mutex
+	subinterpreter bindings.SubInterpreter
+	callbacks      []string
+}
+
+// Runs the script at the specified path in a new subinterpreter and keeps the alias
+// callbacks it registers. Files registered by the script are registered for the task.
+// A timeout of 0 disables the deadline
+func LoadScriptInterpreter(scriptPath string, taskID int, timeout time.Duration) (*ScriptInterpreter, error) {
+	if scriptStat, err := os.Stat(scriptPath); err != nil {
+		return nil, err
+	} else if scriptStat.IsDir() {
+		return nil, errors.New("script path is a directory")
+	}
+
+	return loadScriptInterpreter(timeout, func(subinterpreter bindings.SubInterpreter) bindings.GoVecStringResult {
+		logging.LogDebug("Running python.LoadScriptInterpreter", "thread_id", bindings.OSThreadId())
+		return subinterpreter.LoadAliasCallbacks(scriptPath, int64(taskID))
+	})
+}
+
+// Runs the script inside of a zip archive in a new subinterpreter and keeps the alias
+// callbacks it registers
+func LoadArchiveScriptInterpreter(archive []byte, archiveName string, scriptPath string, taskID int, timeout time.Duration) (*ScriptInterpreter, error) {
+	return loadScriptInterpreter(timeout, func(subinterpreter bindings.SubInterpreter) bindings.GoVecStringResult {
+		logging.LogDebug("Running python.LoadArchiveScriptInterpreter", "thread_id", bindings.OSThreadId())
+		return subinterpreter.LoadArchiveAliasCallbacks(string(archive), archiveName, scriptPath, int64(taskID))
+	})
+}
+
+func loadScriptInterpreter(timeout time.Duration, load func(bindings.SubInterpreter) bindings.GoVecStringResult) (*ScriptInterpreter, error) {
+	subinterpreter := newSubInterpreter()
+
+	result, err := runWithTimeout(subinterpreter, timeout, load, func(result bindings.GoVecStringResult) {
+		bindings.DeleteGoVecStringResult(result)
+		deleteSubInterpreter(subinterpreter)
+	})
+
+	if err != nil {
+		return nil, err
+	}
 	defer bindings.DeleteGoVecStringResult(result)
 
+	interpreter := &ScriptInterpreter{subinterpreter: subinterpreter}
+
 	errv := result.GetSecond()
 	if len(errv) > 0 {
-		err := errors.New(errv)
-		logging.LogError(err, "RunScript returned an error")
-		return []string{}, err
+		interpreter.Close()
+		return nil, errors.New(errv)
 	}
 
-	registerResult := result.GetFirst()
-	registeredAliases := make([]string, registerResult.Size())
-	for i := range registeredAliases {
-		registeredAliases[i] = registerResult.Get(i)
+	callbacks := result.GetFirst()
+	callbackNames := make([]string, callbacks.Size())
+	for i := range callbackNames {
+		callbackNames[i] = callbacks.Get(i)
 	}
 
-	return registeredAliases, nil
+	logging.LogDebug("Loaded alias callbacks", "callbacks", callbackNames)
+	interpreter.callbacks = callbackNames
+	return interpreter, nil
 }
 
-func RunAliasCallback(scriptPath string, taskID int, aliasName string, taskJson string) (string, error) {
-	if scriptStat, err := os.Stat(scriptPath); err != nil {
-		return "", err
-	} else if scriptStat.IsDir() {
-		return "", errors.New("script path is a directory")
+// Returns true if the script registered an alias callback with the name
+func (interpreter *ScriptInterpreter) HasCallback(aliasName string) bool {
+	return slices.Contains(interpreter.callbacks, aliasName)
+}
+
+// Runs an alias callback registered when the interpreter was loaded. A timeout of 0
+// disables the deadline. The interpreter is closed if the callback runs over its timeout
+func (interpreter *ScriptInterpreter) RunAliasCallback(taskID int, aliasName string, taskJson string, timeout time.Duration) (string, error) {
+	interpreter.mutex.Lock()
+	defer interpreter.mutex.Unlock()
+
+	subinterpreter := interpreter.subinterpreter
+	if subinterpreter == nil {
+		return "", errors.New("python subinterpreter was closed")
 	}
 
-	result := withSubInterpreter(func(subinterpreter bindings.SubInterpreter) bindings.GoStringResult {
-		logging.LogDebug("Running python.RunAliasCallback", "thread_id", bindings.OSThreadId())
-		return subinterpreter.RunAliasCallback(scriptPath, int64(taskID), aliasName, taskJson)
+	result, err := runWithTimeout(subinterpreter, timeout, func(sub bindings.SubInterpreter) bindings.GoStringResult {
+		return sub.RunLoadedAliasCallback(int64(taskID), aliasName, taskJson)
+	}, func(result bindings.GoStringResult) {
+		bindings.DeleteGoStringResult(result)
+		deleteSubInterpreter(subinterpreter)
 	})
+
+	if err != nil {
+		interpreter.subinterpreter = nil
+		return "", err
+	}
 	defer bindings.DeleteGoStringResult(result)
 
 	errv := result.GetSecond()
@@ -106,3 +266,18 @@ func RunAliasCallback(scriptPath string, taskID int, aliasName string, taskJson
 
 	return result.GetFirst(), nil
 }
+
+// Deletes the subinterpreter and the alias callbacks it holds once any running alias
+// callback returns
+func (interpreter *ScriptInterpreter) Close() {
+	interpreter.mutex.Lock()
+	defer interpreter.mutex.Unlock()
+
+	subinterpreter := interpreter.subinterpreter
+	if subinterpreter == nil {
+		return
+	}
+
+	interpreter.subinterpreter = nil
+	deleteSubInterpreter(subinterpreter)
+}
@@ -0,0 +1,263 @@
+package signing
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+)
+
+const (
+	// File in the bundle listing the SHA-256 hash of every other file in the bundle
+	ManifestFile = "SHA256SUMS"
+
+	// File in the bundle containing the base64 encoded Ed25519 signature of the manifest
+	SignatureFile = "SHA256SUMS.sig"
+)
+
+// Returned when a bundle does not contain a manifest or signature
+var ErrUnsigned = errors.New("bundle is not signed")
+
+// Public key trusted to sign bundles
+type TrustedKey struct {
+	Name      string
+	PublicKey ed25519.PublicKey
+}
+
+// Parses a list of trusted keys. Each line contains a base64 encoded Ed25519 public
+// key followed by the name of the signer. Empty lines and lines starting with '#' are
+// ignored
+func ParseTrustedKeys(data []byte) ([]TrustedKey, error) {
+	keys := []TrustedKey{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		encodedKey, name, _ := strings.Cut(line, " ")
+		name = strings.TrimSpace(name)
+		if len(name) == 0 {
+			return nil, fmt.Errorf("trusted key on line %d does not have a signer name", lineNum)
+		}
+
+		publicKey, err := base64.StdEncoding.DecodeString(encodedKey)
+		if err != nil {
+			return nil, fmt.Errorf("trusted key on line %d is not valid base64: %w", lineNum, err)
+		} else if len(publicKey) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("trusted key on line %d is not an Ed25519 public key", lineNum)
+		}
+
+		keys = append(keys, TrustedKey{Name: name, PublicKey: ed25519.PublicKey(publicKey)})
+	}
+
+	return keys, scanner.Err()
+}
+
+// Reads the trusted keys from a file. Returns no keys if the path is empty
+func LoadTrustedKeys(keysPath string) ([]TrustedKey, error) {
+	if len(keysPath) == 0 {
+		return []TrustedKey{}, nil
+	}
+
+	data, err := os.ReadFile(keysPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseTrustedKeys(data)
+}
+
+// Returns the line for the public key in a trusted keys file
+func FormatTrustedKey(name string, publicKey ed25519.PublicKey) string {
+	return fmt.Sprintf("%s %s", base64.StdEncoding.EncodeToString(publicKey), name)
+}
+
+// Encodes a private key for storing in a key file
+func EncodePrivateKey(privateKey ed25519.PrivateKey) []byte {
+	return []byte(base64.StdEncoding.EncodeToString(privateKey.Seed()) + "\n")
+}
+
+// Decodes a private key from a key file
+func DecodePrivateKey(data []byte) (ed25519.PrivateKey, error) {
+	seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("private key is not valid base64: %w", err)
+	} else if len(seed) != ed25519.SeedSize {
+		return nil, errors.New("private key is not an Ed25519 private key")
+	}
+
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// Returns the SHA-256 hash of every regular file in the bundle except for the manifest
+// and signature
+func hashBundleFiles(bundle fs.FS) (map[string]string, error) {
+	hashes := map[string]string{}
+
+	err := fs.WalkDir(bundle, ".", func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() || filePath == ManifestFile || filePath == SignatureFile {
+			return nil
+		} else if !entry.Type().IsRegular() {
+			return fmt.Errorf("%s is not a regular file", filePath)
+		}
+
+		file, err := bundle.Open(filePath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		hash := sha256.New()
+		if _, err := io.Copy(hash, file); err != nil {
+			return err
+		}
+
+		hashes[filePath] = hex.EncodeToString(hash.Sum(nil))
+		return nil
+	})
+
+	return hashes, err
+}
+
+// Creates the manifest for the bundle. Each line contains the SHA-256 hash of a file
+// followed by two spaces and the path of the file, in the format of sha256sum
+func BuildManifest(bundle fs.FS) ([]byte, error) {
+	hashes, err := hashBundleFiles(bundle)
+	if err != nil {
+		return nil, err
+	}
+
+	filePaths := make([]string, 0, len(hashes))
+	for filePath := range hashes {
+		filePaths = append(filePaths, filePath)
+	}
+
+	slices.Sort(filePaths)
+
+	var manifest bytes.Buffer
+	for _, filePath := range filePaths {
+		fmt.Fprintf(&manifest, "%s  %s\n", hashes[filePath], filePath)
+	}
+
+	return manifest.Bytes(), nil
+}
+
+func parseManifest(manifest []byte) (map[string]string, error) {
+	hashes := map[string]string{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(manifest))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+		if len(line) == 0 {
+			continue
+		}
+
+		hash, filePath, ok := strings.Cut(line, "  ")
+		if !ok || len(hash) != sha256.Size*2 {
+			return nil, fmt.Errorf("invalid manifest entry on line %d", lineNum)
+		}
+
+		// Entries from sha256sum in binary mode are prefixed with '*'
+		filePath = path.Clean(strings.TrimPrefix(filePath, "*"))
+		hashes[filePath] = strings.ToLower(hash)
+	}
+
+	return hashes, scanner.Err()
+}
+
+// Creates the manifest for the bundle and signs it
+func SignManifest(bundle fs.FS, privateKey ed25519.PrivateKey) ([]byte, []byte, error) {
+	manifest, err := BuildManifest(bundle)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, manifest))
+	return manifest, []byte(signature + "\n"), nil
+}
+
+// Writes a signed manifest for the files in the bundle directory
+func SignBundle(bundleDir string, privateKey ed25519.PrivateKey) error {
+	manifest, signature, err := SignManifest(os.DirFS(bundleDir), privateKey)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(path.Join(bundleDir, ManifestFile), manifest, 0644); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path.Join(bundleDir, SignatureFile), signature, 0644)
+}
+
+// Checks the signature of the bundle manifest against the trusted keys and checks that
+// the files in the bundle match the manifest.
+// Returns the name of the signer or ErrUnsigned if the bundle has no manifest and signature
+func VerifyBundle(bundle fs.FS, keys []TrustedKey) (string, error) {
+	manifest, manifestErr := fs.ReadFile(bundle, ManifestFile)
+	encodedSignature, signatureErr := fs.ReadFile(bundle, SignatureFile)
+
+	if errors.Is(manifestErr, fs.ErrNotExist) && errors.Is(signatureErr, fs.ErrNotExist) {
+		return "", ErrUnsigned
+	} else if manifestErr != nil {
+		return "", fmt.Errorf("could not read bundle manifest: %w", manifestErr)
+	} else if signatureErr != nil {
+		return "", fmt.Errorf("could not read bundle signature: %w", signatureErr)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encodedSignature)))
+	if err != nil {
+		return "", fmt.Errorf("bundle signature is not valid base64: %w", err)
+	}
+
+	keyIdx := slices.IndexFunc(keys, func(key TrustedKey) bool {
+		return ed25519.Verify(key.PublicKey, manifest, signature)
+	})
+
+	if keyIdx < 0 {
+		return "", errors.New("bundle signature does not match any trusted key")
+	}
+
+	signed, err := parseManifest(manifest)
+	if err != nil {
+		return "", err
+	}
+
+	actual, err := hashBundleFiles(bundle)
+	if err != nil {
+		return "", err
+	}
+
+	for filePath, hash := range actual {
+		if signedHash, ok := signed[filePath]; !ok {
+			return "", fmt.Errorf("file %s is not in the signed manifest", filePath)
+		} else if signedHash != hash {
+			return "", fmt.Errorf("file %s does not match the signed manifest", filePath)
+		}
+	}
+
+	for filePath := range signed {
+		if _, ok := actual[filePath]; !ok {
+			return "", fmt.Errorf("file %s from the signed manifest is missing", filePath)
+		}
+	}
+
+	return keys[keyIdx].Name, nil
+}
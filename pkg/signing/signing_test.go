@@ -0,0 +1,105 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestKey(t *testing.T, name string) (TrustedKey, ed25519.PrivateKey) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err, "failed generating test key")
+
+	return TrustedKey{Name: name, PublicKey: publicKey}, privateKey
+}
+
+func createTestBundle(t *testing.T, privateKey ed25519.PrivateKey) fstest.MapFS {
+	bundle := fstest.MapFS{
+		"forgescript_alias.py": {Data: []byte("import forgescript\n")},
+		"bin/x64/whoami.o":     {Data: []byte("object file")},
+	}
+
+	manifest, signature, err := SignManifest(bundle, privateKey)
+	assert.Nil(t, err, "SignManifest() returned an error")
+
+	bundle[ManifestFile] = &fstest.MapFile{Data: manifest}
+	bundle[SignatureFile] = &fstest.MapFile{Data: signature}
+	return bundle
+}
+
+func TestVerifyBundle(t *testing.T) {
+	trusted, privateKey := createTestKey(t, "operator@example")
+	other, _ := createTestKey(t, "other")
+
+	signer, err := VerifyBundle(createTestBundle(t, privateKey), []TrustedKey{other, trusted})
+	assert.Nil(t, err, "VerifyBundle() returned an error for a valid signature")
+	assert.Equal(t, "operator@example", signer)
+}
+
+func TestVerifyUnsignedBundle(t *testing.T) {
+	trusted, _ := createTestKey(t, "operator@example")
+
+	_, err := VerifyBundle(fstest.MapFS{
+		"forgescript_alias.py": {Data: []byte("import forgescript\n")},
+	}, []TrustedKey{trusted})
+	assert.ErrorIs(t, err, ErrUnsigned)
+}
+
+func TestVerifyUntrustedKey(t *testing.T) {
+	trusted, _ := createTestKey(t, "operator@example")
+	_, untrustedKey := createTestKey(t, "untrusted")
+
+	_, err := VerifyBundle(createTestBundle(t, untrustedKey), []TrustedKey{trusted})
+	assert.NotNil(t, err, "VerifyBundle() accepted a bundle signed by an untrusted key")
+	assert.NotErrorIs(t, err, ErrUnsigned)
+}
+
+func TestVerifyModifiedBundle(t *testing.T) {
+	trusted, privateKey := createTestKey(t, "operator@example")
+
+	tests := map[string]func(fstest.MapFS){
+		"modified file": func(bundle fstest.MapFS) {
+			bundle["forgescript_alias.py"] = &fstest.MapFile{Data: []byte("import os\n")}
+		},
+		"added file": func(bundle fstest.MapFS) {
+			bundle["extra.py"] = &fstest.MapFile{Data: []byte("import os\n")}
+		},
+		"removed file": func(bundle fstest.MapFS) {
+			delete(bundle, "bin/x64/whoami.o")
+		},
+		"modified manifest": func(bundle fstest.MapFS) {
+			bundle[ManifestFile].Data = append(bundle[ManifestFile].Data, '\n')
+		},
+		"missing signature": func(bundle fstest.MapFS) {
+			delete(bundle, SignatureFile)
+		},
+	}
+
+	for name, modify := range tests {
+		bundle := createTestBundle(t, privateKey)
+		modify(bundle)
+
+		_, err := VerifyBundle(bundle, []TrustedKey{trusted})
+		assert.NotNil(t, err, "VerifyBundle() accepted a bundle with a %s", name)
+		assert.NotErrorIs(t, err, ErrUnsigned, "bundle with a %s was reported as unsigned", name)
+	}
+}
+
+func TestParseTrustedKeys(t *testing.T) {
+	trusted, privateKey := createTestKey(t, "Jane Operator")
+
+	keys, err := ParseTrustedKeys([]byte("# trusted signers\n\n" + FormatTrustedKey(trusted.Name, trusted.PublicKey) + "\n"))
+	assert.Nil(t, err, "ParseTrustedKeys() returned an error")
+	assert.Equal(t, []TrustedKey{trusted}, keys)
+
+	decoded, err := DecodePrivateKey(EncodePrivateKey(privateKey))
+	assert.Nil(t, err, "DecodePrivateKey() returned an error")
+	assert.Equal(t, privateKey, decoded)
+
+	for _, line := range []string{"not-base64! name", "AAAA name", FormatTrustedKey("", trusted.PublicKey)} {
+		_, err := ParseTrustedKeys([]byte(line))
+		assert.NotNil(t, err, "ParseTrustedKeys() accepted '%s'", line)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/MythicAgents/forgescript/pkg/signing"
+)
+
+// Generates a key pair for signing bundles. The private key is written to a file and
+// the line for the trusted keys file is printed
+func runKeygen(args []string) int {
+	flags := flag.NewFlagSet("keygen", flag.ExitOnError)
+	keyPath := flags.String("key", "forgescript.key", "File to write the private key to")
+	name := flags.String("name", "", "Name of the signer shown when loading signed bundles")
+	flags.Parse(args)
+
+	if len(*name) == 0 {
+		fmt.Fprintf(os.Stderr, "a signer name is required (-name)\n")
+		return 2
+	}
+
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed generating key (%s)\n", err.Error())
+		return 1
+	}
+
+	keyFile, err := os.OpenFile(*keyPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed creating %s (%s)\n", *keyPath, err.Error())
+		return 1
+	}
+	defer keyFile.Close()
+
+	if _, err := keyFile.Write(signing.EncodePrivateKey(privateKey)); err != nil {
+		fmt.Fprintf(os.Stderr, "failed writing %s (%s)\n", *keyPath, err.Error())
+		return 1
+	}
+
+	fmt.Println(signing.FormatTrustedKey(*name, publicKey))
+	return 0
+}
+
+// Writes a signed manifest to a bundle directory before it is archived
+func runSign(args []string) int {
+	flags := flag.NewFlagSet("sign", flag.ExitOnError)
+	keyPath := flags.String("key", "forgescript.key", "File containing the private key")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s sign [-key <file>] <bundle directory>\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	keyData, err := os.ReadFile(*keyPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed reading %s (%s)\n", *keyPath, err.Error())
+		return 1
+	}
+
+	privateKey, err := signing.DecodePrivateKey(keyData)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed reading %s (%s)\n", *keyPath, err.Error())
+		return 1
+	}
+
+	bundleDir := flags.Arg(0)
+	if err := signing.SignBundle(bundleDir, privateKey); err != nil {
+		fmt.Fprintf(os.Stderr, "failed signing %s (%s)\n", bundleDir, err.Error())
+		return 1
+	}
+
+	fmt.Printf("Signed %s\n", bundleDir)
+	return 0
+}